@@ -0,0 +1,109 @@
+package base2048
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+const (
+	// Length in bytes of the checksum appended to the data.
+	checksumSize = 4
+
+	// CRC-32 of any data followed by its CRC-32 in little endian.
+	checksumResidue = 0x2144df1c
+)
+
+// WithChecksum creates a new encoding identical to enc except that
+// the encoder appends the CRC-32 (IEEE) checksum of the data to the data
+// before encoding it, which adds 3 characters to the encoded output, and
+// the decoder verifies and removes it. Decoding fails with ErrChecksum if
+// the checksum does not match, so that a mistyped or missing character is
+// detected instead of decoding into wrong bytes. If enc is constant time,
+// the checksum is computed bit by bit without tables, so that it keeps
+// the guarantee of ConstantTime.
+func (enc Encoding) WithChecksum() *Encoding {
+	enc.checksum = true
+
+	return &enc
+}
+
+// checksumLen returns the length in bytes of the checksum appended to
+// the data.
+func (enc *Encoding) checksumLen() int {
+	if enc.checksum {
+		return checksumSize
+	}
+
+	return 0
+}
+
+// splitChecksum splits src followed by its checksum into the full blocks
+// of src, and the rest of src followed by the checksum, which is stored in
+// buf. The parts can be encoded separately, since head ends at a block
+// boundary.
+func (enc *Encoding) splitChecksum(src []byte, buf *[bytesPerBlock + checksumSize]byte) (head, tail []byte) {
+	k := len(src) - len(src)%bytesPerBlock
+	n := copy(buf[:], src[k:])
+	binary.LittleEndian.PutUint32(buf[n:], enc.checksumOf(src))
+
+	return src[:k], buf[:n+checksumSize]
+}
+
+// checksumOf returns the checksum of src.
+func (enc *Encoding) checksumOf(src []byte) uint32 {
+	if enc.constantTime {
+		return enc.updateChecksum(0, src)
+	}
+
+	return crc32.ChecksumIEEE(src)
+}
+
+// updateChecksum adds the decoded bytes p to crc if enc has a checksum.
+// It does not call crc32.Update, which would move the buffers of the decoders
+// to the heap.
+func (enc *Encoding) updateChecksum(crc uint32, p []byte) uint32 {
+	if !enc.checksum {
+		return crc
+	}
+
+	if enc.constantTime {
+		return updateChecksumBitwise(crc, p)
+	}
+
+	crc = ^crc
+	for _, b := range p {
+		crc = crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+	}
+
+	return ^crc
+}
+
+// updateChecksumBitwise is like updateChecksum but computes the checksum bit
+// by bit without indexing tables by the data, so that the memory access
+// pattern does not depend on the data.
+func updateChecksumBitwise(crc uint32, p []byte) uint32 {
+	crc = ^crc
+	for _, b := range p {
+		crc ^= uint32(b)
+		for k := 0; k < bitsPerByte; k++ {
+			crc = (crc >> 1) ^ (crc32.IEEE & -(crc & 1))
+		}
+	}
+
+	return ^crc
+}
+
+// trimChecksum returns the length of n decoded bytes without the checksum,
+// and ErrChecksum if crc of the bytes shows they are not followed by their
+// checksum.
+func trimChecksum(n int, crc uint32) (int, error) {
+	if n < checksumSize {
+		return 0, ErrChecksum
+	}
+
+	if crc != checksumResidue {
+		return n - checksumSize, ErrChecksum
+	}
+
+	return n - checksumSize, nil
+}
@@ -0,0 +1,185 @@
+package base2048
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChecksumResidue(t *testing.T) {
+	data := benchData(30)
+	for n := 0; n <= len(data); n++ {
+		b := append(append([]byte(nil), data[:n]...), checksumBytes(data[:n])...)
+		testEqual(t, "ChecksumIEEE(%x) = %#x, want %#x", b, crc32.ChecksumIEEE(b), uint32(checksumResidue))
+		testEqual(t, "updateChecksum(%x) = %#x, want %#x", b,
+			DefaultEncoding.WithChecksum().updateChecksum(0, b), uint32(checksumResidue))
+		testEqual(t, "updateChecksumBitwise(%x) = %#x, want %#x", b,
+			updateChecksumBitwise(0, b), uint32(checksumResidue))
+	}
+}
+
+func TestWithChecksum(t *testing.T) {
+	encodings := []*Encoding{
+		DefaultEncoding.WithChecksum(),
+		DefaultEncoding.WithChecksum().WithLineWrap(5, CRLF).WithLinePrefix("# ").WithGroups(2, '-'),
+		DefaultEncoding.ConstantTime().WithChecksum(),
+		DefaultEncoding.WithChecksum().ConstantTime(),
+	}
+	data := benchData(30)
+
+	for _, enc := range encodings {
+		for n := 0; n <= len(data); n++ {
+			src := data[:n]
+			want := enc.EncodeToString(src)
+
+			plain := DefaultEncoding.EncodeToString(append(append([]byte(nil), src...), checksumBytes(src)...))
+			testEqual(t, "EncodeToString(%x) = %q, want %q", src, stripSeparators(enc, want), plain)
+
+			testEqual(t, "EncodedLen(%d) = %d, want %d", n, enc.EncodedLen(n), utf8.RuneCountInString(want))
+			testEqual(t, "EncodedByteLen(%x) = %d, want %d", src, enc.EncodedByteLen(src), len(want))
+
+			if max := enc.MaxEncodedByteLen(n); max < len(want) {
+				t.Errorf("MaxEncodedByteLen(%d) = %d, want >= %d", n, max, len(want))
+			}
+
+			rbuf := make([]rune, enc.EncodedLen(n))
+			enc.Encode(rbuf, src)
+			testEqual(t, "Encode(%x) = %q, want %q", src, string(rbuf), want)
+
+			bb := &bytes.Buffer{}
+			encoder := NewEncoder(enc, bb)
+			_, _ = encoder.Write(src)
+			_ = encoder.Close()
+			_ = encoder.Close()
+			testEqual(t, "NewEncoder(%x) = %q, want %q", src, bb.String(), want)
+
+			testEqual(t, "DecodedLenExact(%q) = %d, want %d", want, enc.DecodedLenExact(rbuf), n)
+			testEqual(t, "DecodedLenExactString(%q) = %d, want %d", want, enc.DecodedLenExactString(want), n)
+
+			dbuf := make([]byte, enc.DecodedLen(len(rbuf)))
+			m, err := enc.Decode(dbuf, rbuf)
+			testEqual(t, "Decode(%q) = error %v, want %v", want, err, error(nil))
+			testEqual(t, "Decode(%q) = %x, want %x", want, string(dbuf[:m]), string(src))
+
+			m, err = enc.ValidRunes(rbuf)
+			if m != n || err != nil {
+				t.Errorf("ValidRunes(%q) = %d, %v, want %d, %v", want, m, err, n, error(nil))
+			}
+
+			m, err = enc.Valid(want)
+			if m != n || err != nil {
+				t.Errorf("Valid(%q) = %d, %v, want %d, %v", want, m, err, n, error(nil))
+			}
+
+			dbuf, err = enc.DecodeString(want)
+			testEqual(t, "DecodeString(%q) = error %v, want %v", want, err, error(nil))
+			testEqual(t, "DecodeString(%q) = %x, want %x", want, string(dbuf), string(src))
+
+			dbuf, err = enc.AppendDecode([]byte("x"), []byte(want))
+			testEqual(t, "AppendDecode(%q) = error %v, want %v", want, err, error(nil))
+			testEqual(t, "AppendDecode(%q) = %x, want %x", want, string(dbuf), "x"+string(src))
+
+			dbuf, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(want)))
+			testEqual(t, "NewDecoder(%q) = error %v, want %v", want, err, error(nil))
+			testEqual(t, "NewDecoder(%q) = %x, want %x", want, string(dbuf), string(src))
+		}
+	}
+}
+
+func TestWithChecksumDefaultUnchanged(t *testing.T) {
+	for _, p := range testsets {
+		testEqual(t, "EncodeToString(%q) = %q, want %q", p.decoded,
+			DefaultEncoding.EncodeToString([]byte(p.decoded)), p.encoded)
+	}
+
+	enc := DefaultEncoding.WithChecksum()
+	testEqual(t, "EncodedLen(0) = %d, want %d", enc.EncodedLen(0), 3)
+	testEqual(t, "EncodedLen(0) = %d, want %d", DefaultEncoding.EncodedLen(0), 0)
+}
+
+func TestWithChecksumError(t *testing.T) {
+	enc := DefaultEncoding.WithChecksum()
+	src := []byte("foobarbazqux")
+	encoded := []rune(enc.EncodeToString(src))
+
+	testerrors := []string{
+		// empty input
+		"",
+		// too short for the checksum
+		string(encoded[:2]),
+		// missing character
+		string(encoded[:len(encoded)-2]) + string(encoded[len(encoded)-1]),
+		// mistyped character
+		string(encoded[:3]) + string(enc.encode[(enc.lookup(encoded[3])+1)%encoderSize]) + string(encoded[4:]),
+		// without the checksum
+		DefaultEncoding.EncodeToString(src),
+	}
+
+	for _, s := range testerrors {
+		_, err := enc.DecodeString(s)
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("DecodeString(%q) = error %v, want %v", s, err, ErrChecksum)
+		}
+
+		_, err = enc.Valid(s)
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("Valid(%q) = error %v, want %v", s, err, ErrChecksum)
+		}
+
+		_, err = enc.Decode(make([]byte, enc.DecodedLen(len(s))), []rune(s))
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("Decode(%q) = error %v, want %v", s, err, ErrChecksum)
+		}
+
+		_, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(s)))
+		if !errors.Is(err, ErrChecksum) {
+			t.Errorf("NewDecoder(%q) = error %v, want %v", s, err, ErrChecksum)
+		}
+	}
+}
+
+func TestWithChecksumMaxDecodedLen(t *testing.T) {
+	enc := DefaultEncoding.WithChecksum().WithMaxDecodedLen(12)
+
+	for _, n := range []int{12, 13} {
+		src := benchData(n)
+		encoded := enc.EncodeToString(src)
+
+		var want error
+		if n > 12 {
+			want = ErrTooLarge
+		}
+
+		_, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", encoded, err, want)
+
+		_, err = enc.Valid(encoded)
+		testEqual(t, "Valid(%q) = error %v, want %v", encoded, err, want)
+
+		dbuf, err := ioutil.ReadAll(NewDecoder(enc, strings.NewReader(encoded)))
+		testEqual(t, "NewDecoder(%q) = error %v, want %v", encoded, err, want)
+		testEqual(t, "NewDecoder(%q) = %x, want %x", encoded, string(dbuf), string(src[:12]))
+	}
+}
+
+// checksumBytes returns the checksum appended to src by WithChecksum.
+func checksumBytes(src []byte) []byte {
+	b := make([]byte, checksumSize)
+	binary.LittleEndian.PutUint32(b, crc32.ChecksumIEEE(src))
+
+	return b
+}
+
+// stripSeparators removes the line breaks, line prefixes and group separators
+// of enc from s.
+func stripSeparators(enc *Encoding, s string) string {
+	s = strings.ReplaceAll(s, string(enc.lineBreak), "")
+	s = strings.TrimPrefix(s, string(enc.linePrefix))
+
+	return strings.ReplaceAll(s, string(enc.groupSep), "")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/Milly/go-base2048"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// runAlphabet runs the alphabet subcommand, and returns the exit status.
+func runAlphabet(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("base2048 alphabet", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: base2048 alphabet")
+		fmt.Fprintln(stderr, "Print the characters of the encoding with their code points and Unicode names.")
+	}
+
+	if code, ok := parseFlags(fs, args, 0, stderr); !ok {
+		return code
+	}
+
+	if err := printAlphabet(stdout); err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// printAlphabet writes a table of the encoder and trailing characters of
+// the default encoding to w.
+func printAlphabet(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SET\tINDEX\tCODE\tCHAR\tNAME")
+
+	for i, r := range base2048.DefaultEncodeChars {
+		fmt.Fprintf(tw, "%s\t%d\tU+%04X\t%c\t%s\n", setEncoder, i, r, r, runenames.Name(r))
+	}
+
+	for i, r := range base2048.DefaultTrailingChars {
+		fmt.Fprintf(tw, "%s\t%d\tU+%04X\t%c\t%s\n", setTail, i, r, r, runenames.Name(r))
+	}
+
+	return tw.Flush() //nolint:wrapcheck
+}
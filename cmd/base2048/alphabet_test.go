@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Milly/go-base2048"
+)
+
+func TestAlphabet(t *testing.T) {
+	code, stdout, stderr := testRun(t, []string{"alphabet"}, "")
+	if code != exitOK || stderr != "" {
+		t.Fatalf("run(alphabet) = %v, %q, want %v, %q", code, stderr, exitOK, "")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if want := 1 + len(base2048.DefaultEncodeChars) + len(base2048.DefaultTrailingChars); len(lines) != want {
+		t.Fatalf("run(alphabet) = %d lines, want %d", len(lines), want)
+	}
+
+	for _, want := range []string{
+		"SET      INDEX  CODE    CHAR  NAME",
+		"encoder  0      U+00D8  Ø     LATIN CAPITAL LETTER O WITH STROKE",
+		"tail     7      U+0F12  ༒     TIBETAN MARK RGYA GRAM SHAD",
+	} {
+		if !strings.Contains(stdout, want+"\n") {
+			t.Errorf("run(alphabet) does not contain %q", want)
+		}
+	}
+
+	if code, _, _ := testRun(t, []string{"alphabet", "x"}, ""); code != exitUsage {
+		t.Errorf("run(alphabet x) = %v, want %v", code, exitUsage)
+	}
+}
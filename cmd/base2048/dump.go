@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Milly/go-base2048"
+)
+
+// runDump runs the dump subcommand, and returns the exit status.
+func runDump(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("base2048 dump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: base2048 dump [-d] [FILE]")
+		fmt.Fprintln(stderr, "Print the bytes of FILE, or standard input, in hex side by side with the base2048 characters.")
+		fs.PrintDefaults()
+	}
+
+	decode := fs.Bool("d", false, "decode base2048 input before dumping")
+
+	if code, ok := parseFlags(fs, args, 1, stderr); !ok {
+		return code
+	}
+
+	in, err := openInput(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if *decode {
+		r = base2048.NewDecoder(base2048.DefaultEncoding, in)
+	}
+
+	w := bufio.NewWriter(stdout)
+	dumper := base2048.NewDumper(base2048.DefaultEncoding, w)
+
+	// Dump the bytes decoded before an error too.
+	_, err = io.Copy(dumper, r)
+
+	if cerr := dumper.Close(); err == nil {
+		err = cerr
+	}
+
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
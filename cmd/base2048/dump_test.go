@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Milly/go-base2048"
+)
+
+func TestDump(t *testing.T) {
+	input := "foobarbazquxfoo"
+	encoded := base2048.DefaultEncoding.EncodeToString([]byte(input))
+	runes := []rune(encoded)
+	want := "00000000  66 6f 6f 62 61 72 62 61 7a 71 75  |" + string(runes[:8]) + "|\n" +
+		"0000000b  78 66 6f 6f                       |" + string(runes[8:]) + "|\n"
+
+	code, stdout, stderr := testRun(t, []string{"dump"}, input)
+	if code != exitOK || stdout != want || stderr != "" {
+		t.Errorf("run(dump) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, want, "")
+	}
+
+	code, stdout, stderr = testRun(t, []string{"dump", "-d"}, encoded+"\n")
+	if code != exitOK || stdout != want || stderr != "" {
+		t.Errorf("run(dump -d) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, want, "")
+	}
+}
+
+func TestDumpError(t *testing.T) {
+	want := "00000000  66 6f                             |" + base2048.DefaultEncoding.EncodeToString([]byte("fo")) + "|\n"
+	wantErr := "base2048: illegal base2048 data at input 2 (line 1, column 3): invalid character 'Z'\n"
+
+	code, stdout, stderr := testRun(t, []string{"dump", "-d"}, "\xD5\x93\xDA\x9DZ")
+	if code != exitError || stdout != want || stderr != wantErr {
+		t.Errorf("run(dump -d) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitError, want, wantErr)
+	}
+}
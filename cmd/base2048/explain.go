@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Milly/go-base2048"
+)
+
+// runExplain runs the explain subcommand, and returns the exit status.
+func runExplain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("base2048 explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: base2048 explain [FILE]")
+		fmt.Fprintln(stderr, "Print each character of the encoded FILE, or standard input, with the bytes it decodes into.")
+		fmt.Fprintln(stderr, "Unused high bits of the last character are shown in parentheses.")
+	}
+
+	if code, ok := parseFlags(fs, args, 1, stderr); !ok {
+		return code
+	}
+
+	in, err := openInput(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+	defer in.Close()
+
+	data, err := ioutil.ReadAll(in)
+	if err == nil {
+		err = explain(stdout, string(data))
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// explain writes a table of the characters of s to w. Each row shows
+// the offset, line and column, code point, set, index and bits of
+// the character, the bytes completed by the character, and the reason if
+// decoding fails at the character. It returns the error of decoding s.
+func explain(w io.Writer, s string) error {
+	decoded, decodeErr := base2048.DefaultEncoding.DecodeString(s)
+
+	var de *base2048.DecodeError
+	if !errors.As(decodeErr, &de) {
+		de = nil
+	}
+
+	alphabet := newAlphabet()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OFFSET\tLINE:COL\tCODE\tCHAR\tSET\tINDEX\tBITS\tBYTES\tERROR")
+
+	var (
+		offset    int64
+		line, col = 1, 1
+		chars     int // number of data characters
+		total     int // number of all the data characters
+	)
+
+	for _, r := range s {
+		if _, ok := alphabet[r]; ok {
+			total++
+		}
+	}
+
+	for _, r := range s {
+		var set, index, bits, bytes, reason string
+
+		c, ok := alphabet[r]
+
+		switch {
+		case r == '\r' || r == '\n':
+			set = "newline"
+		case !ok:
+			set = "invalid"
+		default:
+			set, index = c.set, strconv.Itoa(c.index)
+
+			if c.set == setEncoder {
+				used := 11
+				if chars == total-1 {
+					// The last character completes the last byte.
+					used -= (chars + 1) * 11 % 8
+				}
+
+				bits = formatBits(c.index, 11, used)
+			} else {
+				// The trailing character completes the last byte.
+				bits = formatBits(c.index, 3, 8-chars*11%8)
+			}
+
+			// Bytes whose last bit is in the character.
+			start, end := chars*11/8, (chars+1)*11/8
+			if end > len(decoded) {
+				end = len(decoded)
+			}
+
+			if start < end {
+				bytes = fmt.Sprintf("% X", decoded[start:end])
+			}
+
+			chars++
+		}
+
+		if de != nil && de.Offset == offset {
+			reason = de.Reason.String()
+		}
+
+		fmt.Fprintf(tw, "%d\t%d:%d\tU+%04X\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			offset, line, col, r, strconv.QuoteRune(r), set, index, bits, bytes, reason)
+
+		offset++
+
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return decodeErr
+}
+
+// formatBits formats the index of size bits, of which only the low used bits
+// are decoded. The unused high bits, which must be zero in strict decoding,
+// are put in parentheses.
+func formatBits(index, size, used int) string {
+	if used >= size {
+		return fmt.Sprintf("%0*b", used, index)
+	}
+
+	b := fmt.Sprintf("%0*b", size, index)
+
+	return "(" + b[:size-used] + ")" + b[size-used:]
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	code, stdout, stderr := testRun(t, []string{"explain"}, "\xD5\x93\xDA\x9D\xE0\xB6\xAA\xE0\xB0\xA8\xC5\x8A\n")
+	want := strings.Join([]string{
+		"OFFSET  LINE:COL  CODE    CHAR  SET      INDEX  BITS           BYTES  ERROR",
+		"0       1:1       U+0553  'Փ'   encoder  819    01100110011    66     ",
+		"1       1:2       U+069D  'ڝ'   encoder  987    01111011011    6F     ",
+		"2       1:3       U+0DAA  'ඪ'   encoder  1732   11011000100    6F 62  ",
+		"3       1:4       U+0C28  'న'   encoder  1559   11000010111    61     ",
+		"4       1:5       U+014A  'Ŋ'   encoder  2      (0000000)0010  72     ",
+		"5       1:6       U+000A  '\\n'  newline                               ",
+		"",
+	}, "\n")
+
+	if code != exitOK || stdout != want || stderr != "" {
+		t.Errorf("run(explain) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, want, "")
+	}
+}
+
+// TestExplainUsedBits shows that only the bits decoded from the last
+// character are outside the parentheses.
+func TestExplainUsedBits(t *testing.T) {
+	testsets := []struct {
+		input string
+		want  []string
+	}{
+		// "x" is decoded from 8 bits of the only character.
+		{"\xC7\x80", []string{
+			"OFFSET  LINE:COL  CODE    CHAR  SET      INDEX  BITS           BYTES  ERROR",
+			"0       1:1       U+01C0  'ǀ'   encoder  120    (000)01111000  78     ",
+		}},
+		// "foo" is decoded from 2 bits of the trailing character.
+		{"\xD5\x93\xDA\x9D\xE0\xBC\x90", []string{
+			"OFFSET  LINE:COL  CODE    CHAR  SET      INDEX  BITS         BYTES  ERROR",
+			"0       1:1       U+0553  'Փ'   encoder  819    01100110011  66     ",
+			"1       1:2       U+069D  'ڝ'   encoder  987    01111011011  6F     ",
+			"2       1:3       U+0F10  '༐'   tail     3      (0)11        6F     ",
+		}},
+	}
+
+	for _, p := range testsets {
+		code, stdout, stderr := testRun(t, []string{"explain"}, p.input)
+		want := strings.Join(append(p.want, ""), "\n")
+
+		if code != exitOK || stdout != want || stderr != "" {
+			t.Errorf("run(explain) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, want, "")
+		}
+	}
+}
+
+func TestExplainError(t *testing.T) {
+	code, stdout, stderr := testRun(t, []string{"explain"}, "\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93")
+	want := strings.Join([]string{
+		"OFFSET  LINE:COL  CODE    CHAR  SET      INDEX  BITS           BYTES  ERROR",
+		"0       1:1       U+0553  'Փ'   encoder  819    01100110011    66     ",
+		"1       1:2       U+069D  'ڝ'   encoder  987    01111011011    6F     ",
+		"2       1:3       U+0F10  '༐'   tail     3      (0)11                 trailing character not at the end",
+		"3       1:4       U+0553  'Փ'   encoder  819    (0110)0110011         ",
+		"",
+	}, "\n")
+	wantErr := "base2048: illegal base2048 data at input 2 (line 1, column 3): trailing character not at the end '༐'\n"
+
+	if code != exitError || stdout != want || stderr != wantErr {
+		t.Errorf("run(explain) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitError, want, wantErr)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/Milly/go-base2048/cmd/base2048
+
+go 1.15
+
+require (
+	github.com/Milly/go-base2048 v0.0.0-00010101000000-000000000000
+	golang.org/x/text v0.3.8
+)
+
+replace github.com/Milly/go-base2048 => ../..
@@ -0,0 +1,216 @@
+// Command base2048 encodes or decodes a file or standard input to standard
+// output using the default base2048 encoding, like base64 of coreutils.
+//
+// Usage:
+//
+//	base2048 [-d] [-i] [-w COLS] [FILE]
+//	base2048 explain [FILE]
+//	base2048 alphabet
+//	base2048 dump [-d] [FILE]
+//
+// With no FILE, or when FILE is -, it reads standard input.
+//
+// The explain subcommand prints each character of the encoded input with
+// its code point, the set it belongs to, its index and the bytes it
+// completes, to find the character that breaks decoding.
+//
+// The alphabet subcommand prints the characters of the default encoding with
+// their code points and Unicode names.
+//
+// The dump subcommand prints the bytes of the input in hex side by side with
+// the base2048 characters encoding them, or with -d, the bytes decoded from
+// the base2048 input.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Milly/go-base2048"
+)
+
+// Exit status codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// Default number of characters per line of the encoded output.
+const defaultWrap = 76
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments args, and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "explain":
+			return runExplain(args[1:], stdin, stdout, stderr)
+		case "alphabet":
+			return runAlphabet(args[1:], stdout, stderr)
+		case "dump":
+			return runDump(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	fs := flag.NewFlagSet("base2048", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: base2048 [-d] [-i] [-w COLS] [FILE]")
+		fmt.Fprintln(stderr, "       base2048 explain [FILE]")
+		fmt.Fprintln(stderr, "       base2048 alphabet")
+		fmt.Fprintln(stderr, "       base2048 dump [-d] [FILE]")
+		fmt.Fprintln(stderr, "Base2048 encode or decode FILE, or standard input, to standard output.")
+		fs.PrintDefaults()
+	}
+
+	decode := fs.Bool("d", false, "decode data")
+	ignoreGarbage := fs.Bool("i", false, "when decoding, ignore non-alphabet characters")
+	wrap := fs.Int("w", defaultWrap, "wrap encoded lines after `COLS` characters, 0 to disable")
+
+	if code, ok := parseFlags(fs, args, 1, stderr); !ok {
+		return code
+	}
+
+	in, err := openInput(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+	defer in.Close()
+
+	w := bufio.NewWriter(stdout)
+
+	if *decode {
+		err = decodeStream(w, in, *ignoreGarbage)
+	} else {
+		err = encodeStream(w, in, *wrap)
+	}
+
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "base2048: %v\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// parseFlags parses args with fs, allowing at most maxArgs arguments. It
+// returns false and the exit status if the command should exit.
+func parseFlags(fs *flag.FlagSet, args []string, maxArgs int, stderr io.Writer) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+
+		return exitUsage, false
+	}
+
+	if fs.NArg() > maxArgs {
+		fmt.Fprintf(stderr, "base2048: extra operand %q\n", fs.Arg(maxArgs))
+		fs.Usage()
+
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+// openInput opens the file name, or returns stdin if name is empty or "-".
+func openInput(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+
+	return os.Open(name) //nolint:wrapcheck
+}
+
+// encodeStream encodes r into w, in lines of width characters.
+func encodeStream(w io.Writer, r io.Reader, width int) error {
+	encoder := base2048.NewEncoder(base2048.DefaultEncoding.WithLineWrap(width, base2048.LF), w)
+
+	n, err := io.Copy(encoder, r)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// End the last line, as base64 does.
+	if n > 0 {
+		_, err = io.WriteString(w, "\n")
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// decodeStream decodes r into w. If ignoreGarbage is true, it skips
+// characters other than the characters of the encoding.
+func decodeStream(w io.Writer, r io.Reader, ignoreGarbage bool) error {
+	enc := base2048.DefaultEncoding
+	if ignoreGarbage {
+		enc = enc.WithIgnore(notInAlphabet())
+	}
+
+	_, err := io.Copy(w, base2048.NewDecoder(enc, r))
+
+	return err //nolint:wrapcheck
+}
+
+// notInAlphabet returns a function reporting whether r is not a character of
+// the default encoding.
+func notInAlphabet() func(r rune) bool {
+	alphabet := newAlphabet()
+
+	return func(r rune) bool {
+		_, ok := alphabet[r]
+
+		return !ok
+	}
+}
+
+// Sets of the characters of the encoding.
+const (
+	setEncoder = "encoder"
+	setTail    = "tail"
+)
+
+// char is a character of the encoding.
+type char struct {
+	set   string
+	index int
+}
+
+// alphabet maps the characters of the default encoding to their sets and
+// indexes.
+type alphabet map[rune]char
+
+func newAlphabet() alphabet {
+	a := make(alphabet, len(base2048.DefaultEncodeChars)+len(base2048.DefaultTrailingChars))
+
+	for i, r := range base2048.DefaultEncodeChars {
+		a[r] = char{setEncoder, i}
+	}
+
+	for i, r := range base2048.DefaultTrailingChars {
+		a[r] = char{setTail, i}
+	}
+
+	return a
+}
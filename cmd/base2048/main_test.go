@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Milly/go-base2048"
+)
+
+func testRun(t *testing.T, args []string, stdin string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	outbuf, errbuf := &bytes.Buffer{}, &bytes.Buffer{}
+	code = run(args, strings.NewReader(stdin), outbuf, errbuf)
+
+	return code, outbuf.String(), errbuf.String()
+}
+
+func TestEncode(t *testing.T) {
+	input := strings.Repeat("foobarbazqux", 20)
+	encoded := base2048.DefaultEncoding.WithLineWrap(defaultWrap, base2048.LF).EncodeToString([]byte(input)) + "\n"
+
+	code, stdout, stderr := testRun(t, nil, input)
+	if code != exitOK || stdout != encoded || stderr != "" {
+		t.Errorf("run() = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, encoded, "")
+	}
+
+	runes := []rune(base2048.DefaultEncoding.EncodeToString([]byte("foobarbazqux")))
+	want := string(runes[:4]) + "\n" + string(runes[4:8]) + "\n" + string(runes[8:]) + "\n"
+
+	code, stdout, _ = testRun(t, []string{"-w", "4"}, "foobarbazqux")
+	if code != exitOK || stdout != want {
+		t.Errorf("run(-w 4) = %v, %q, want %v, %q", code, stdout, exitOK, want)
+	}
+
+	code, stdout, _ = testRun(t, []string{"-w", "0"}, input)
+	if want := base2048.DefaultEncoding.EncodeToString([]byte(input)) + "\n"; code != exitOK || stdout != want {
+		t.Errorf("run(-w 0) = %v, %q, want %v, %q", code, stdout, exitOK, want)
+	}
+
+	code, stdout, _ = testRun(t, nil, "")
+	if code != exitOK || stdout != "" {
+		t.Errorf("run() = %v, %q, want %v, %q", code, stdout, exitOK, "")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	input := strings.Repeat("foobarbazqux", 20)
+	encoded := base2048.DefaultEncoding.WithLineWrap(defaultWrap, base2048.LF).EncodeToString([]byte(input)) + "\n"
+
+	code, stdout, stderr := testRun(t, []string{"-d"}, encoded)
+	if code != exitOK || stdout != input || stderr != "" {
+		t.Errorf("run(-d) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitOK, input, "")
+	}
+
+	garbage := "> " + strings.ReplaceAll(encoded, "\n", " |\n> ")
+
+	code, stdout, _ = testRun(t, []string{"-d", "-i"}, garbage)
+	if code != exitOK || stdout != input {
+		t.Errorf("run(-d -i) = %v, %q, want %v, %q", code, stdout, exitOK, input)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	code, stdout, stderr := testRun(t, []string{"-d"}, "\xD5\x93\xDA\x9D\n Z")
+	want := "base2048: illegal base2048 data at input 3 (line 2, column 1): invalid character ' '\n"
+
+	if code != exitError || stdout != "fo" || stderr != want {
+		t.Errorf("run(-d) = %v, %q, %q, want %v, %q, %q", code, stdout, stderr, exitError, "fo", want)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "base2048")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(name, []byte("foobar"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	want := base2048.DefaultEncoding.EncodeToString([]byte("foobar")) + "\n"
+
+	code, stdout, _ := testRun(t, []string{name}, "")
+	if code != exitOK || stdout != want {
+		t.Errorf("run(%q) = %v, %q, want %v, %q", name, code, stdout, exitOK, want)
+	}
+
+	code, _, stderr := testRun(t, []string{filepath.Join(dir, "missing")}, "")
+	if code != exitError || !strings.HasPrefix(stderr, "base2048: ") {
+		t.Errorf("run(missing) = %v, %q, want %v", code, stderr, exitError)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := testRun(t, []string{"-x"}, ""); code != exitUsage {
+		t.Errorf("run(-x) = %v, want %v", code, exitUsage)
+	}
+
+	if code, _, _ := testRun(t, []string{"a", "b"}, ""); code != exitUsage {
+		t.Errorf("run(a b) = %v, want %v", code, exitUsage)
+	}
+
+	if code, _, stderr := testRun(t, []string{"-h"}, ""); code != exitOK || !strings.Contains(stderr, "Usage:") {
+		t.Errorf("run(-h) = %v, %q, want %v", code, stderr, exitOK)
+	}
+}
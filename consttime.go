@@ -0,0 +1,81 @@
+package base2048
+
+import "crypto/subtle"
+
+// ConstantTime creates a new encoding identical to enc except that
+// the characters are looked up in constant time, for encoding secret data
+// such as private keys. The encoder and the decoder read every character of
+// the encoding instead of indexing tables by the data, so that the running
+// time and the memory access pattern do not depend on the data, but they are
+// much slower.
+//
+// Encode and Decode, which work on runes, are fully covered. The UTF-8
+// encoded output of EncodeToString, AppendEncode and NewEncoder, and its
+// length, depends on the lengths of the characters, unless all the
+// characters of the encoding have the same length in UTF-8. The checksum set
+// by WithChecksum is computed bit by bit without tables. Errors for invalid
+// input and the functions set by WithIgnore are not constant time.
+func (enc Encoding) ConstantTime() *Encoding {
+	enc.constantTime = true
+
+	return &enc
+}
+
+// encodeChar returns the character of the encoder for the index x.
+func (enc *Encoding) encodeChar(x uint16) rune {
+	if enc.constantTime {
+		return selectChar(enc.encode[:], x)
+	}
+
+	return enc.encode[x]
+}
+
+// tailChar returns the trailing character for the index x.
+func (enc *Encoding) tailChar(x uint16) rune {
+	if enc.constantTime {
+		return selectChar(enc.tail[:], x)
+	}
+
+	return enc.tail[x]
+}
+
+// selectChar returns table[x] by reading every element of table.
+func selectChar(table []rune, x uint16) rune {
+	var r rune
+
+	for k, c := range table {
+		r |= c & -rune(subtle.ConstantTimeEq(int32(k), int32(x)))
+	}
+
+	return r
+}
+
+// lookupChar is like lookup but looks up r in constant time if enc is
+// constant time. The decoder uses it instead of the fast paths with lookup.
+func (enc *Encoding) lookupChar(r rune) uint16 {
+	if enc.constantTime {
+		return enc.lookupConstantTime(r)
+	}
+
+	return enc.lookup(r)
+}
+
+// lookupConstantTime is like lookup but compares r with every character of
+// the encoding.
+func (enc *Encoding) lookupConstantTime(r rune) uint16 {
+	var v, found int
+
+	for k, c := range enc.encode {
+		eq := subtle.ConstantTimeEq(c, r)
+		v |= k & -eq
+		found |= eq
+	}
+
+	for k, c := range enc.tail {
+		eq := subtle.ConstantTimeEq(c, r)
+		v |= (tailOffset + k) & -eq
+		found |= eq
+	}
+
+	return uint16(subtle.ConstantTimeSelect(found, v, invalidIndex))
+}
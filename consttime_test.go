@@ -0,0 +1,90 @@
+package base2048
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestConstantTime(t *testing.T) {
+	enc := DefaultEncoding.ConstantTime()
+	data := benchData(30)
+
+	for n := 0; n <= len(data); n++ {
+		want := DefaultEncoding.EncodeToString(data[:n])
+		testEqual(t, "EncodeToString(%x) = %q, want %q", data[:n], enc.EncodeToString(data[:n]), want)
+
+		rbuf := make([]rune, enc.EncodedLen(n))
+		enc.Encode(rbuf, data[:n])
+		testEqual(t, "Encode(%x) = %q, want %q", data[:n], string(rbuf), want)
+
+		dbuf := make([]byte, enc.DecodedLen(len(rbuf)))
+		m, err := enc.Decode(dbuf, rbuf)
+		testEqual(t, "Decode(%q) = error %v, want %v", want, err, error(nil))
+		testEqual(t, "Decode(%q) = %x, want %x", want, string(dbuf[:m]), string(data[:n]))
+
+		dbuf, err = enc.DecodeString(want)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", want, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %x, want %x", want, string(dbuf), string(data[:n]))
+
+		dbuf, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(want)))
+		testEqual(t, "NewDecoder(%q) = error %v, want %v", want, err, error(nil))
+		testEqual(t, "NewDecoder(%q) = %x, want %x", want, string(dbuf), string(data[:n]))
+	}
+}
+
+func TestConstantTimeDecodeError(t *testing.T) {
+	enc := DefaultEncoding.ConstantTime()
+	testerrors := []string{
+		"Z",
+		"\xD5\x93\xDA\x9D\xE0\xB6\xAA\xE0\xB0\xA8Z\xC5\x8A",
+		"\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93",
+		"\xD5\x93\xDA\x9D\xE0\xBC\x91",
+		"\xD5\x93\xDA",
+	}
+
+	for _, encoded := range testerrors {
+		_, want := DefaultEncoding.DecodeString(encoded)
+		_, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString([% X]) = error %v, want %v", encoded, err.Error(), want.Error())
+	}
+}
+
+func TestLookupConstantTime(t *testing.T) {
+	enc := DefaultEncoding
+
+	for _, r := range DefaultEncodeChars {
+		testEqual(t, "lookupConstantTime(%q) = %v, want %v", r, enc.lookupConstantTime(r), enc.lookup(r))
+	}
+
+	for _, r := range DefaultTrailingChars {
+		testEqual(t, "lookupConstantTime(%q) = %v, want %v", r, enc.lookupConstantTime(r), enc.lookup(r))
+	}
+
+	for _, r := range []rune{0, 'Z', '\n', utf8.MaxRune, utf8.MaxRune + 1, -1} {
+		testEqual(t, "lookupConstantTime(%q) = %v, want %v", r, enc.lookupConstantTime(r), uint16(invalidIndex))
+	}
+}
+
+func BenchmarkEncodeConstantTime(b *testing.B) {
+	enc := DefaultEncoding.ConstantTime()
+	data := benchData(256)
+	buf := make([]rune, enc.EncodedLen(len(data)))
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		enc.Encode(buf, data)
+	}
+}
+
+func BenchmarkDecodeConstantTime(b *testing.B) {
+	enc := DefaultEncoding.ConstantTime()
+	data := []rune(enc.EncodeToString(benchData(256)))
+	buf := make([]byte, enc.DecodedLen(len(data)))
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		_, _ = enc.Decode(buf, data)
+	}
+}
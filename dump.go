@@ -0,0 +1,121 @@
+package base2048
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Width of the hex bytes column of the dumper, "xx " for each byte of
+// a block without the last space.
+const dumpHexWidth = bytesPerBlock*3 - 1
+
+var errDumperClosed = errors.New("base2048: dumper closed")
+
+type dumper struct {
+	enc    *Encoding
+	w      io.Writer
+	buf    [bytesPerBlock]byte // buffered data of the current line
+	nbuf   int                 // number of bytes in buf
+	offset int64               // offset of the current line
+	line   []byte              // output buffer
+	closed bool
+}
+
+// NewDumper returns a WriteCloser that writes a dump of all written data to
+// w, like hex.Dumper. Each line shows the offset, 11 bytes in hex and
+// the 8 characters encoding them using enc, such as:
+//
+//	00000000  66 6f 6f 62 61 72 62 61 7a 71 75  |ՓڝඪనɹΜཅΊ|
+//
+// Line wrapping, line prefix, groups and the checksum of enc are not used,
+// since each line shows only the characters of its own bytes. The last line
+// shows the characters of the remaining bytes, which are written when
+// the dumper is closed.
+func NewDumper(enc *Encoding, w io.Writer) io.WriteCloser {
+	return &dumper{enc: enc, w: w}
+}
+
+func (d *dumper) Write(p []byte) (n int, err error) {
+	if d.closed {
+		return 0, errDumperClosed
+	}
+
+	for len(p) > 0 {
+		k := copy(d.buf[d.nbuf:], p)
+		d.nbuf += k
+		n += k
+		p = p[k:]
+
+		if d.nbuf == bytesPerBlock {
+			if err := d.writeLine(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the last line of the remaining bytes.
+func (d *dumper) Close() error {
+	if d.closed {
+		return nil
+	}
+
+	d.closed = true
+
+	if d.nbuf == 0 {
+		return nil
+	}
+
+	return d.writeLine()
+}
+
+// writeLine writes the line of the buffered bytes.
+func (d *dumper) writeLine() error {
+	src := d.buf[:d.nbuf]
+
+	line := d.line[:0]
+	line = appendHex(line, uint64(d.offset), 8)
+	line = append(line, ' ', ' ')
+
+	for i, b := range src {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+
+		line = appendHex(line, uint64(b), 2)
+	}
+
+	for i := len(src)*3 - 1; i < dumpHexWidth; i++ {
+		line = append(line, ' ')
+	}
+
+	var chars [charsPerBlock]rune
+
+	n := d.enc.dataLen(len(src))
+	d.enc.encodeData(chars[:n], src)
+
+	line = append(line, ' ', ' ', '|')
+	line = appendRunes(line, chars[:n])
+	line = append(line, '|', '\n')
+
+	d.line = line
+	d.offset += int64(d.nbuf)
+	d.nbuf = 0
+
+	_, err := d.w.Write(line)
+
+	return err //nolint:wrapcheck
+}
+
+// appendHex appends v in lower case hex of at least width digits to dst.
+func appendHex(dst []byte, v uint64, width int) []byte {
+	s := strconv.FormatUint(v, 16)
+	for i := len(s); i < width; i++ {
+		dst = append(dst, '0')
+	}
+
+	return append(dst, s...)
+}
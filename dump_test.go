@@ -0,0 +1,59 @@
+package base2048
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestDumper also shows that the formatting and the checksum of the encoding
+// are not used.
+func TestDumper(t *testing.T) {
+	input := []byte("foobarbazquxfoo")
+	runes := []rune(DefaultEncoding.EncodeToString(input[:11]))
+	rest := DefaultEncoding.EncodeToString(input[11:])
+	want := "00000000  66 6f 6f 62 61 72 62 61 7a 71 75  |" + string(runes) + "|\n" +
+		"0000000b  78 66 6f 6f                       |" + rest + "|\n"
+
+	for bs := 1; bs <= len(input); bs++ {
+		bb := &bytes.Buffer{}
+		dumper := NewDumper(DefaultEncoding.WithLineWrap(3, CRLF).WithGroups(2, ' ').WithChecksum(), bb)
+
+		for pos := 0; pos < len(input); pos += bs {
+			end := pos + bs
+			if end > len(input) {
+				end = len(input)
+			}
+
+			n, err := dumper.Write(input[pos:end])
+			testEqual(t, "Write() = error %v, want %v", err, error(nil))
+			testEqual(t, "Write() = length %v, want %v", n, end-pos)
+		}
+
+		err := dumper.Close()
+		testEqual(t, "Close() = error %v, want %v", err, error(nil))
+		testEqual(t, "Dump/%d = %q, want %q", bs, bb.String(), want)
+	}
+}
+
+func TestDumperEmpty(t *testing.T) {
+	bb := &bytes.Buffer{}
+	dumper := NewDumper(DefaultEncoding, bb)
+	err := dumper.Close()
+	testEqual(t, "Close() = error %v, want %v", err, error(nil))
+	testEqual(t, "Dump = %q, want %q", bb.String(), "")
+
+	_, err = dumper.Write([]byte("foo"))
+	testEqual(t, "Write() after Close() = error %v, want %v", err, errDumperClosed)
+}
+
+func TestDumperWriteError(t *testing.T) {
+	want := errors.New("write error")
+	dumper := NewDumper(DefaultEncoding, &errorWriter{want})
+
+	_, err := dumper.Write([]byte("foo"))
+	testEqual(t, "Write() = error %v, want %v", err, error(nil))
+
+	err = dumper.Close()
+	testEqual(t, "Close() = error %v, want %v", err, want)
+}
@@ -1,96 +1,508 @@
 // Package base2048 implements base2048 encoding of binary data
 package base2048
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 const (
 	bitsPerChar  = 11
 	bitsPerByte  = 8
 	encoderSize  = 2048
 	trailingSize = 8
+
+	// 11 bytes (88 bits) are exactly encoded into 8 characters.
+	bytesPerBlock = 11
+	charsPerBlock = 8
+
+	// Maximum number of bytes written by decoding a character.
+	maxBytesPerChar = 2
+
+	maxInt = int(^uint(0) >> 1)
+
+	// The decode table is split into pages of 256 code points.
+	decodePageBits = 8
+	decodePageSize = 1 << decodePageBits
+	decodePages    = utf8.MaxRune>>decodePageBits + 1
+
+	// Values of the decode table. Characters of the encoder are mapped to
+	// their indexes, and characters of the trailing are mapped to their
+	// indexes plus encoderSize.
+	tailOffset   = encoderSize
+	invalidIndex = 0xffff
 )
 
 // Encoding is a radix 2048 encoding/decoding scheme, defined by
 // a 2048 unicode characters and a trailing 8 unicode characters.
 // It has no standard (RFC, etc...) specifications.
 type Encoding struct {
-	encode    [encoderSize]rune
-	decodeMap map[rune]uint16
-	tail      [trailingSize]rune
-	tailMap   map[rune]uint16
+	encode      [encoderSize]rune
+	tail        [trailingSize]rune
+	decodePage  [decodePages]uint16      // page numbers of code points
+	decodeTable [][decodePageSize]uint16 // pages of the decode table
+
+	maxRuneLen int // maximum length in bytes of the UTF-8 encoded characters
+
+	lineWidth  int    // number of characters per line, or 0 for no wrapping
+	linePrefix []rune // characters at the start of each line
+	lineBreak  []rune // characters between lines, line ending and prefix
+	groupSize  int    // number of characters per group, or 0 for no grouping
+	groupSep   []rune // character between groups
+
+	strict bool // reject newlines and non-canonical characters on decoding
+
+	maxDecodedLen int // maximum length in bytes of the decoded data, or 0
+
+	ignore func(r rune) bool // characters skipped on decoding, other than newlines
+
+	constantTime bool // look up characters in constant time
+
+	checksum bool // append the checksum to the data on encoding
 }
 
+// Line endings for WithLineWrap.
+const (
+	LF   = "\n"
+	CRLF = "\r\n"
+)
+
 // NewEncoding returns a new Encoding defined by the given unicode characters,
 // which should be a 2048-characters slice for encoder and a 8-characters slice
-// for trailing.
+// for trailing. It panics if the characters are not valid, see NewEncodingE.
 func NewEncoding(encoder []rune, trailing []rune) *Encoding {
+	enc, err := NewEncodingE(encoder, trailing)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return enc
+}
+
+// NewEncodingE is like NewEncoding but returns an error instead of panicking
+// if the characters are not valid. All the characters must be distinct valid
+// unicode code points, and must not be newline characters (\r and \n) or
+// the replacement character (U+FFFD).
+func NewEncodingE(encoder []rune, trailing []rune) (*Encoding, error) {
 	if len(encoder) != encoderSize {
-		panic("encoder is not 2048 characters")
+		return nil, errors.New("encoder is not 2048 characters")
 	}
 
 	if len(trailing) != trailingSize {
-		panic("trailing is not 8 characters")
+		return nil, errors.New("trailing is not 8 characters")
 	}
 
 	for i := 0; i < len(encoder); i++ {
 		if encoder[i] == '\n' || encoder[i] == '\r' {
-			panic("encoder contains newline character")
+			return nil, errors.New("encoder contains newline character")
 		}
 	}
 
 	for i := 0; i < len(trailing); i++ {
 		if trailing[i] == '\n' || trailing[i] == '\r' {
-			panic("trailing contains newline character")
+			return nil, errors.New("trailing contains newline character")
 		}
 	}
 
 	enc := new(Encoding)
 	copy(enc.encode[:], encoder)
 	copy(enc.tail[:], trailing)
-	enc.decodeMap = make(map[rune]uint16, len(encoder))
-	enc.tailMap = make(map[rune]uint16, len(trailing))
 
-	for i := 0; i < len(encoder); i++ {
-		enc.decodeMap[encoder[i]] = uint16(i)
+	// The first page is shared by code points without any characters.
+	enc.decodeTable = [][decodePageSize]uint16{newDecodePage()}
+
+	for i, r := range encoder {
+		switch {
+		case !validChar(r):
+			return nil, fmt.Errorf("encoder contains invalid character %U at %d", r, i)
+		case enc.lookup(r) != invalidIndex:
+			return nil, fmt.Errorf("encoder contains duplicate character %U at %d", r, i)
+		}
+
+		enc.setDecode(r, uint16(i))
 	}
 
-	for i := 0; i < len(trailing); i++ {
-		enc.tailMap[trailing[i]] = uint16(i)
+	for i, r := range trailing {
+		switch {
+		case !validChar(r):
+			return nil, fmt.Errorf("trailing contains invalid character %U at %d", r, i)
+		case enc.lookup(r) < tailOffset:
+			return nil, fmt.Errorf("trailing contains encoder character %U at %d", r, i)
+		case enc.lookup(r) != invalidIndex:
+			return nil, fmt.Errorf("trailing contains duplicate character %U at %d", r, i)
+		}
+
+		enc.setDecode(r, uint16(tailOffset+i))
 	}
 
-	return enc
+	for _, r := range enc.encode {
+		if n := utf8.RuneLen(r); n > enc.maxRuneLen {
+			enc.maxRuneLen = n
+		}
+	}
+
+	for _, r := range enc.tail {
+		if n := utf8.RuneLen(r); n > enc.maxRuneLen {
+			enc.maxRuneLen = n
+		}
+	}
+
+	return enc, nil
+}
+
+// validChar reports whether r can be a character of the encoding.
+func validChar(r rune) bool {
+	return utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// newDecodePage returns a page of the decode table without any characters.
+func newDecodePage() [decodePageSize]uint16 {
+	var page [decodePageSize]uint16
+	for i := range page {
+		page[i] = invalidIndex
+	}
+
+	return page
+}
+
+// setDecode sets the value of the character r in the decode table.
+func (enc *Encoding) setDecode(r rune, v uint16) {
+	page := enc.decodePage[r>>decodePageBits]
+	if page == 0 {
+		page = uint16(len(enc.decodeTable))
+		enc.decodePage[r>>decodePageBits] = page
+		enc.decodeTable = append(enc.decodeTable, newDecodePage())
+	}
+
+	enc.decodeTable[page][r&(decodePageSize-1)] = v
+}
+
+// lookup returns the value of the character r in the decode table, or
+// invalidIndex if r is not a character of the encoding.
+func (enc *Encoding) lookup(r rune) uint16 {
+	if uint32(r) > utf8.MaxRune {
+		return invalidIndex
+	}
+
+	return enc.decodeTable[enc.decodePage[r>>decodePageBits]][r&(decodePageSize-1)]
 }
 
 // DefaultEncoding is the default base2048 encoding defined in this module.
 var DefaultEncoding = NewEncoding(DefaultEncodeChars, DefaultTrailingChars) //nolint:gochecknoglobals
 
+// WithLineWrap creates a new encoding identical to enc except with
+// the encoded output split into lines of width characters, separated by
+// the lineEnding which must be LF or CRLF. There is no line ending after
+// the last line. A width of zero or less disables line wrapping.
+func (enc Encoding) WithLineWrap(width int, lineEnding string) *Encoding {
+	if lineEnding != LF && lineEnding != CRLF {
+		panic("invalid line ending")
+	}
+
+	if width < 0 {
+		width = 0
+	}
+
+	enc.lineWidth = width
+	enc.lineBreak = []rune(lineEnding + string(enc.linePrefix))
+
+	return &enc
+}
+
+// WithLinePrefix creates a new encoding identical to enc except with
+// the prefix at the start of each line of the encoded output, such as
+// "// " or "# ". The prefix is stripped from the start of each line when
+// decoding. It must not contain newline characters or characters of
+// the encoding.
+func (enc Encoding) WithLinePrefix(prefix string) *Encoding {
+	runes := []rune(prefix)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\n' || runes[i] == '\r' {
+			panic("line prefix contains newline character")
+		}
+
+		if enc.lookup(runes[i]) != invalidIndex {
+			panic("line prefix contains encoding character")
+		}
+	}
+
+	lineEnding := LF
+	if len(enc.lineBreak) > 0 && enc.lineBreak[0] == '\r' {
+		lineEnding = CRLF
+	}
+
+	enc.linePrefix = runes
+	enc.lineBreak = []rune(lineEnding + prefix)
+
+	return &enc
+}
+
+// WithGroups creates a new encoding identical to enc except with
+// the encoded output split into groups of size characters, separated by
+// the sep character, such as ' ' or '-', for reading and copying by hand.
+// Groups start at the start of each line. The separator is skipped when
+// decoding, unless the encoding is strict, so grouped output cannot be
+// decoded strictly. It must be a valid character, other than utf8.RuneError,
+// and must not be a newline character or a character of the encoding. A size
+// of zero or less disables grouping.
+func (enc Encoding) WithGroups(size int, sep rune) *Encoding {
+	if !validChar(sep) {
+		panic("group separator is invalid character")
+	}
+
+	if isNewline(sep) {
+		panic("group separator is newline character")
+	}
+
+	if enc.lookup(sep) != invalidIndex {
+		panic("group separator is encoding character")
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	enc.groupSize = size
+	enc.groupSep = []rune{sep}
+
+	return &enc
+}
+
+// Strict creates a new encoding identical to enc except with strict
+// decoding enabled. In this mode, the decoder skips no characters, so it
+// rejects new line characters, line prefixes and group separators, even in
+// the output of enc itself, and requires the last character to be the one
+// the encoder produces, that is, the unused bits of the last character must
+// be zero and the trailing character must only be used for the last 1 to 3
+// bits.
+func (enc Encoding) Strict() *Encoding {
+	enc.strict = true
+
+	return &enc
+}
+
+// WithMaxDecodedLen creates a new encoding identical to enc except that
+// decoding fails with ErrTooLarge if the decoded data is longer than n bytes.
+// The decoders return the first n bytes with the error, except DecodeString,
+// which checks the length before allocating the result. A limit of zero or
+// less disables the check.
+func (enc Encoding) WithMaxDecodedLen(n int) *Encoding {
+	if n < 0 {
+		n = 0
+	}
+
+	enc.maxDecodedLen = n
+
+	return &enc
+}
+
+// tooLarge reports whether n bytes of the decoded data exceed the limit.
+func (enc *Encoding) tooLarge(n int) bool {
+	return enc.maxDecodedLen > 0 && n > enc.maxDecodedLen
+}
+
+// WithIgnore creates a new encoding identical to enc except that
+// the decoder also skips the characters for which ignore returns true, in
+// addition to new line characters (\r and \n). It panics if ignore returns
+// true for any character of the encoding. A nil ignore skips only new line
+// characters. Strict encodings skip no characters.
+func (enc Encoding) WithIgnore(ignore func(r rune) bool) *Encoding {
+	if ignore != nil {
+		for _, r := range enc.encode {
+			if ignore(r) {
+				panic("ignore set contains encoding character")
+			}
+		}
+
+		for _, r := range enc.tail {
+			if ignore(r) {
+				panic("ignore set contains encoding character")
+			}
+		}
+	}
+
+	enc.ignore = ignore
+
+	return &enc
+}
+
+// IgnoreSpaces reports whether r is a space character that is often mixed
+// into copied and pasted text, to be used with WithIgnore. Such characters
+// are white spaces including no-break spaces, zero width spaces, byte order
+// marks and bidirectional text control characters.
+func IgnoreSpaces(r rune) bool {
+	switch r {
+	case '\u200b', // zero width space
+		'\u200c', '\u200d', // zero width non-joiner and joiner
+		'\u2060',                     // word joiner
+		'\ufeff',                     // byte order mark
+		'\u061c', '\u200e', '\u200f': // bidirectional marks
+		return true
+	}
+
+	// Bidirectional embeddings, overrides and isolates.
+	if '\u202a' <= r && r <= '\u202e' || '\u2066' <= r && r <= '\u2069' {
+		return true
+	}
+
+	return unicode.IsSpace(r)
+}
+
+// ignored reports whether the decoder skips the character r.
+func (enc *Encoding) ignored(r rune) bool {
+	return !enc.strict && (isNewline(r) || enc.isGroupSep(r) || enc.ignore != nil && enc.ignore(r))
+}
+
+// isGroupSep reports whether r is the group separator.
+func (enc *Encoding) isGroupSep(r rune) bool {
+	return enc.groupSize > 0 && r == enc.groupSep[0]
+}
+
+// isNewline reports whether r is a new line character.
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// formatted reports whether the encoded output contains characters other
+// than the encoded data.
+func (enc *Encoding) formatted() bool {
+	return enc.lineWidth > 0 || len(enc.linePrefix) > 0 || enc.groupSize > 0
+}
+
+// separator returns the characters inserted before the i-th character of
+// the encoded data.
+func (enc *Encoding) separator(i int) []rune {
+	col := i
+	if enc.lineWidth > 0 {
+		col = i % enc.lineWidth
+	}
+
+	switch {
+	case i == 0:
+		return enc.linePrefix
+	case col == 0:
+		return enc.lineBreak
+	case enc.groupSize > 0 && col%enc.groupSize == 0:
+		return enc.groupSep
+	}
+
+	return nil
+}
+
 // Encode encodes src using the encoding enc, writing
 // EncodedLen(len(src)) characters to dst.
 func (enc *Encoding) Encode(dst []rune, src []byte) {
-	if len(src) == 0 {
+	if len(src) == 0 && !enc.checksum {
 		return
 	}
 
+	// Encode the data into the end of dst, then move the characters
+	// forward inserting separators. The characters are never overwritten
+	// before being read, because the number of the separators written
+	// never exceeds the offset of the data.
+	n := enc.payloadLen(len(src))
+	off := enc.EncodedLen(len(src)) - n
+
+	var buf [bytesPerBlock + checksumSize]byte
+
+	head, tail := enc.payload(src, &buf)
+	k := enc.encodeData(dst[off:], head)
+	enc.encodeData(dst[off+k:], tail)
+
+	if !enc.formatted() {
+		return
+	}
+
+	di := 0
+	for i := 0; i < n; i++ {
+		r := dst[off+i]
+		di += copy(dst[di:], enc.separator(i))
+		dst[di] = r
+		di++
+	}
+}
+
+// encodeData encodes src into dst without any separators, and returns
+// the number of characters written.
+func (enc *Encoding) encodeData(dst []rune, src []byte) int {
+	di := 0
+
+	for len(src) > 0 {
+		var block []byte
+
+		block, src = nextBlock(src)
+		di += enc.encodeBlockChars(dst[di:], block)
+	}
+
+	return di
+}
+
+// payload splits src followed by its checksum, if enc has one, into parts
+// to be encoded in order. The checksum is stored in buf.
+func (enc *Encoding) payload(src []byte, buf *[bytesPerBlock + checksumSize]byte) (head, tail []byte) {
+	if !enc.checksum {
+		return src, nil
+	}
+
+	return enc.splitChecksum(src, buf)
+}
+
+// nextBlock splits src into the first block, which is partial at the end of
+// src, and the rest.
+func nextBlock(src []byte) (block, rest []byte) {
+	if len(src) < bytesPerBlock {
+		return src, nil
+	}
+
+	return src[:bytesPerBlock], src[bytesPerBlock:]
+}
+
+// encodeBlockChars encodes src, which is a full block or the last partial
+// block, into chars and returns the number of characters. It is shared by
+// all encoders, so the bits are split in one place.
+func (enc *Encoding) encodeBlockChars(chars []rune, src []byte) int {
 	// enc is a pointer receiver, so the use of enc.encode within the hot
-	// loop below means a nil check at every operation. Lift that nil check
-	// outside of the loop to speed up the encoder.
+	// loops below means a nil check at every operation. Lift that nil check
+	// outside of the loops to speed up the encoder.
 	_ = enc.encode
 
+	// Encode a full block with fixed shifts.
+	if len(src) == bytesPerBlock {
+		var index [charsPerBlock]uint16
+
+		encodeBlock(&index, src)
+
+		_ = chars[charsPerBlock-1] // bounds check hint to compiler
+
+		for k, x := range index {
+			chars[k] = enc.encodeChar(x)
+		}
+
+		return charsPerBlock
+	}
+
 	var (
 		stage     uint16
 		remaining uint8
-		di        int
+		n         int
 	)
 
-	se := len(src)
-	for si := 0; si < se; si++ {
-		b := uint16(src[si])
+	// Encode the last partial block bit by bit.
+	for _, c := range src {
+		b := uint16(c)
 
 		need := bitsPerChar - remaining
 		if need <= bitsPerByte {
 			remaining = bitsPerByte - need
 			index := (stage << need) | (b >> remaining)
 			stage = b & ((1 << remaining) - 1)
-			dst[di] = enc.encode[index]
-			di++
+			chars[n] = enc.encodeChar(index)
+			n++
 		} else {
 			remaining += bitsPerByte
 			stage = (stage << bitsPerByte) | b
@@ -98,110 +510,967 @@ func (enc *Encoding) Encode(dst []rune, src []byte) {
 	}
 
 	if remaining == 0 {
-		return
+		return n
 	}
 
 	// Add the remaining small block
 	if remaining <= (bitsPerChar - bitsPerByte) {
-		dst[di] = enc.tail[stage]
+		chars[n] = enc.tailChar(stage)
 	} else {
-		dst[di] = enc.encode[stage]
+		chars[n] = enc.encodeChar(stage)
 	}
+
+	return n + 1
+}
+
+// encodeBlock splits the 88 bits of the 11-byte block src into indexes of
+// 8 characters.
+func encodeBlock(index *[charsPerBlock]uint16, src []byte) {
+	_ = src[bytesPerBlock-1] // bounds check hint to compiler
+
+	hi := binary.BigEndian.Uint64(src)                             // bits 0-63
+	lo := uint32(src[8])<<16 | uint32(src[9])<<8 | uint32(src[10]) // bits 64-87
+
+	index[0] = uint16(hi >> 53)
+	index[1] = uint16(hi>>42) & 0x7ff
+	index[2] = uint16(hi>>31) & 0x7ff
+	index[3] = uint16(hi>>20) & 0x7ff
+	index[4] = uint16(hi>>9) & 0x7ff
+	index[5] = uint16(hi<<2|uint64(lo>>22)) & 0x7ff
+	index[6] = uint16(lo>>11) & 0x7ff
+	index[7] = uint16(lo) & 0x7ff
+}
+
+// decodeBlock joins the indexes of 8 characters into the 88 bits of
+// the 11-byte block dst.
+func decodeBlock(dst []byte, index *[charsPerBlock]uint16) {
+	_ = dst[bytesPerBlock-1] // bounds check hint to compiler
+
+	hi := uint64(index[0])<<53 | uint64(index[1])<<42 | uint64(index[2])<<31 |
+		uint64(index[3])<<20 | uint64(index[4])<<9 | uint64(index[5])>>2
+	lo := uint32(index[5]&3)<<22 | uint32(index[6])<<11 | uint32(index[7])
+
+	binary.BigEndian.PutUint64(dst, hi)
+	dst[8] = byte(lo >> 16)
+	dst[9] = byte(lo >> 8)
+	dst[10] = byte(lo)
 }
 
 // EncodeToString returns the base2048 encoding of src.
 func (enc *Encoding) EncodeToString(src []byte) string {
-	buf := make([]rune, enc.EncodedLen(len(src)))
-	enc.Encode(buf, src)
+	return string(enc.AppendEncode(nil, src))
+}
+
+// AppendEncode appends the base2048 encoding of src to dst as UTF-8
+// and returns the extended buffer.
+func (enc *Encoding) AppendEncode(dst, src []byte) []byte {
+	if len(src) == 0 && !enc.checksum {
+		return dst
+	}
 
-	return string(buf)
+	if n := len(dst) + enc.MaxEncodedByteLen(len(src)); n > cap(dst) {
+		buf := make([]byte, len(dst), n)
+		copy(buf, dst)
+		dst = buf
+	}
+
+	var buf [bytesPerBlock + checksumSize]byte
+
+	head, tail := enc.payload(src, &buf)
+	dst = enc.appendEncode(dst, head, 0)
+
+	return enc.appendEncode(dst, tail, enc.dataLen(len(head)))
+}
+
+// appendEncode appends the base2048 encoding of src to dst as UTF-8, where
+// the first character is the i-th character of the encoded data.
+func (enc *Encoding) appendEncode(dst, src []byte, i int) []byte {
+	var chars [charsPerBlock]rune
+
+	formatted := enc.formatted()
+
+	for len(src) > 0 {
+		var block []byte
+
+		block, src = nextBlock(src)
+
+		for _, r := range chars[:enc.encodeBlockChars(chars[:], block)] {
+			if formatted {
+				dst = appendRunes(dst, enc.separator(i))
+			}
+
+			dst = appendRune(dst, r)
+			i++
+		}
+	}
+
+	return dst
 }
 
 // EncodedLen returns the length in characters of the base2048 encoding
-// of an input buffer of bytes length n.
+// of an input buffer of bytes length n, including line breaks, line prefixes
+// and group separators. It panics if the result overflows int.
 func (enc *Encoding) EncodedLen(n int) int {
-	return (n*bitsPerByte + bitsPerChar - 1) / bitsPerChar
+	chars := enc.payloadLen(n)
+	lines := enc.lines(chars)
+
+	if lines == 0 {
+		return chars
+	}
+
+	n = addLen(chars, len(enc.linePrefix))
+	n = addLen(n, mulLen(lines-1, len(enc.lineBreak)))
+
+	return addLen(n, enc.groupSeps(chars))
+}
+
+// MaxEncodedByteLen returns the maximum length in bytes of the UTF-8 encoded
+// base2048 encoding of an input buffer of bytes length n, including line
+// breaks, line prefixes and group separators. It is computed from the widest
+// character of the encoding. It panics if the result overflows int.
+func (enc *Encoding) MaxEncodedByteLen(n int) int {
+	chars := enc.payloadLen(n)
+
+	return addLen(mulLen(chars, enc.maxRuneLen), enc.separatorsByteLen(chars))
+}
+
+// EncodedByteLen returns the exact length in bytes of the UTF-8 encoded
+// base2048 encoding of src, including line breaks, line prefixes and group
+// separators. It panics if the result overflows int.
+func (enc *Encoding) EncodedByteLen(src []byte) int {
+	var buf [bytesPerBlock + checksumSize]byte
+
+	head, tail := enc.payload(src, &buf)
+	n := addLen(enc.dataByteLen(head), enc.dataByteLen(tail))
+
+	return addLen(n, enc.separatorsByteLen(enc.payloadLen(len(src))))
+}
+
+// dataByteLen returns the length in bytes of the UTF-8 encoded data of src
+// without any separators.
+func (enc *Encoding) dataByteLen(src []byte) int {
+	var (
+		chars [charsPerBlock]rune
+		n     int
+	)
+
+	for len(src) > 0 {
+		var block []byte
+
+		block, src = nextBlock(src)
+
+		for _, r := range chars[:enc.encodeBlockChars(chars[:], block)] {
+			n += utf8.RuneLen(r)
+		}
+	}
+
+	return n
+}
+
+// lines returns the number of lines of the encoded output containing chars
+// characters of the encoded data, or 0 if there are no separators.
+func (enc *Encoding) lines(chars int) int {
+	switch {
+	case chars == 0 || !enc.formatted():
+		return 0
+	case enc.lineWidth > 0:
+		return (chars + enc.lineWidth - 1) / enc.lineWidth
+	}
+
+	return 1
+}
+
+// separatorsByteLen returns the length in bytes of the UTF-8 encoded
+// separators in the encoded output containing chars characters of
+// the encoded data.
+func (enc *Encoding) separatorsByteLen(chars int) int {
+	lines := enc.lines(chars)
+	if lines == 0 {
+		return 0
+	}
+
+	n := addLen(runesLen(enc.linePrefix), mulLen(lines-1, runesLen(enc.lineBreak)))
+
+	return addLen(n, mulLen(enc.groupSeps(chars), runesLen(enc.groupSep)))
+}
+
+// groupSeps returns the number of group separators in the encoded output
+// containing chars characters of the encoded data.
+func (enc *Encoding) groupSeps(chars int) int {
+	if chars == 0 || enc.groupSize == 0 {
+		return 0
+	}
+
+	if enc.lineWidth == 0 {
+		return (chars - 1) / enc.groupSize
+	}
+
+	n := mulLen(chars/enc.lineWidth, (enc.lineWidth-1)/enc.groupSize)
+	if rest := chars % enc.lineWidth; rest > 0 {
+		n += (rest - 1) / enc.groupSize
+	}
+
+	return n
+}
+
+// dataLen returns the length in characters of the encoded data of
+// an input buffer of bytes length n, excluding any separators.
+func (enc *Encoding) dataLen(n int) int {
+	// Split n into full blocks and the rest to avoid overflow.
+	return n/bytesPerBlock*charsPerBlock + (n%bytesPerBlock*bitsPerByte+bitsPerChar-1)/bitsPerChar
+}
+
+// payloadLen returns the length in characters of the encoded data of
+// an input buffer of bytes length n followed by its checksum, if enc has one,
+// excluding any separators.
+func (enc *Encoding) payloadLen(n int) int {
+	return enc.dataLen(addLen(n, enc.checksumLen()))
+}
+
+// addLen returns a + b of non-negative lengths. It panics if the result
+// overflows int.
+func addLen(a, b int) int {
+	if a > maxInt-b {
+		panic("length overflows int")
+	}
+
+	return a + b
+}
+
+// mulLen returns a * b of non-negative lengths. It panics if the result
+// overflows int.
+func mulLen(a, b int) int {
+	if b != 0 && a > maxInt/b {
+		panic("length overflows int")
+	}
+
+	return a * b
 }
 
 // Decode decodes src using the encoding enc. It writes at most
 // DecodedLen(len(src)) bytes to dst and returns the number of bytes
 // written. If src contains invalid base2048 data, it will return
-// the number of bytes successfully written and CorruptInputError.
-// New line characters (\r and \n) are ignored.
+// the number of bytes successfully written and *DecodeError, which can be
+// converted to CorruptInputError, or also to NonCanonicalError for
+// non-canonical input, with errors.As.
+// New line characters (\r and \n) and the characters set by WithIgnore are
+// ignored, and the line prefix of the encoding is stripped from the start of
+// each line, unless the encoding is strict.
 func (enc *Encoding) Decode(dst []byte, src []rune) (n int, err error) {
-	if len(src) == 0 {
-		return 0, nil
-	}
+	return enc.decode(dst, src, false)
+}
 
-	// Lift the nil check outside of the loop. enc.decodeMap is directly
-	// used later in this function, to let the compiler know that the
-	// receiver can't be nil.
-	_ = enc.decodeMap
+// ValidRunes reports whether src is valid base2048 data, with the same
+// checks as Decode but without writing the decoded bytes. It returns
+// the exact length in bytes of the decoded data, or the number of bytes
+// decoded before the illegal data and *DecodeError.
+func (enc *Encoding) ValidRunes(src []rune) (int, error) {
+	return enc.decode(nil, src, true)
+}
 
+// decode decodes src into dst. If discard is true, the decoded bytes are
+// counted but not written, and dst may be nil.
+func (enc *Encoding) decode(dst []byte, src []rune, discard bool) (n int, err error) {
 	var (
-		stage     uint32
-		remaining uint8
-		residue   uint8
+		d         = newCharDecoder(enc)
+		pendingAt int // index of the pending character
+		index     [charsPerBlock]uint16
+		scratch   [bytesPerBlock]byte
 	)
 
-	// Truncate trailing newline characters
-	se := len(src) - 1
-	for se >= 0 && (src[se] == '\r' || src[se] == '\n') {
-		se--
+	// out returns the buffer for the bytes decoded next.
+	out := func() []byte {
+		if discard {
+			return scratch[:]
+		}
+
+		return dst[n:]
 	}
 
-	for si := 0; si <= se; si++ {
-		if src[si] == '\r' || src[si] == '\n' {
+	for si := 0; si < len(src); si++ {
+		if d.tooLarge(n) {
+			return enc.maxDecodedLen, ErrTooLarge
+		}
+
+		if d.atLineStart() && enc.hasLinePrefix(src[si:]) {
+			d.endLineStart()
+			si += len(enc.linePrefix) - 1
+
 			continue
 		}
 
-		residue = (residue + bitsPerChar) % bitsPerByte
+		r := src[si]
+
+		if d.skip(r) {
+			continue
+		}
 
-		var (
-			newBits      uint16
-			newBitsCount uint8
-			ok           bool
-		)
+		written, reason := d.flush(out(), false)
+		n += written
 
-		if newBits, ok = enc.decodeMap[src[si]]; ok {
-			if si == se {
-				newBitsCount = bitsPerChar - residue
-			} else {
-				newBitsCount = bitsPerChar
+		if reason != 0 {
+			return n, decodeError(runesPosition(src, pendingAt), d.pending, reason)
+		}
+
+		// Decode a full block with fixed shifts. The last character of
+		// a full block is decoded in the same way even if it is the last
+		// character of the input.
+		if d.st.aligned() && enc.lookupBlock(&index, src[si:]) {
+			d.decodeBlock(out(), &index)
+			n += bytesPerBlock
+			si += charsPerBlock - 1
+
+			continue
+		}
+
+		d.hold(r)
+		pendingAt = si
+	}
+
+	written, reason := d.flush(out(), true)
+	n += written
+
+	if reason != 0 {
+		return n, decodeError(runesPosition(src, pendingAt), d.pending, reason)
+	}
+
+	return d.finish(n)
+}
+
+// hasLinePrefix reports whether src begins with the line prefix.
+func (enc *Encoding) hasLinePrefix(src []rune) bool {
+	if len(src) < len(enc.linePrefix) {
+		return false
+	}
+
+	for i, r := range enc.linePrefix {
+		if src[i] != r {
+			return false
+		}
+	}
+
+	return true
+}
+
+// charDecoder decodes characters one by one. It is shared by the decoders of
+// runes, UTF-8 encoded bytes and streams, which only differ in how they read
+// the characters and write the decoded bytes. The line prefix is stripped
+// while atLineStart, other characters are passed to skip, and the rest are
+// decoded by flush and hold, or by decodeBlock for a full block.
+type charDecoder struct {
+	enc        *Encoding
+	st         decodeState
+	lineStart  bool
+	pending    rune // last character, which is not decoded yet
+	hasPending bool
+	crc        uint32 // checksum of the decoded bytes
+}
+
+// newCharDecoder returns a new charDecoder at the start of the input.
+func newCharDecoder(enc *Encoding) charDecoder {
+	return charDecoder{enc: enc, lineStart: true}
+}
+
+// atLineStart reports whether the line prefix is stripped if the input
+// continues with it, that is, no character but the skipped ones is found
+// since the start of the line.
+func (d *charDecoder) atLineStart() bool {
+	return d.lineStart && !d.enc.strict && len(d.enc.linePrefix) > 0
+}
+
+// endLineStart records that the line prefix is stripped.
+func (d *charDecoder) endLineStart() {
+	d.lineStart = false
+}
+
+// skip reports whether r is skipped, and tracks the start of lines.
+func (d *charDecoder) skip(r rune) bool {
+	if d.enc.ignored(r) {
+		d.lineStart = d.lineStart || isNewline(r)
+
+		return true
+	}
+
+	d.lineStart = false
+
+	return false
+}
+
+// flush decodes the pending character, if any, into dst. The last must be
+// true at the end of the input, since the last character is decoded
+// differently. It returns the number of bytes written, and the reason if
+// the character is not allowed at this position.
+func (d *charDecoder) flush(dst []byte, last bool) (int, Reason) {
+	// Return early without a call, since most characters are not pending.
+	if !d.hasPending {
+		return 0, 0
+	}
+
+	return d.decodePending(dst, last)
+}
+
+// decodePending decodes the pending character into dst.
+func (d *charDecoder) decodePending(dst []byte, last bool) (int, Reason) {
+	d.hasPending = false
+	n, reason := d.enc.decodeChar(&d.st, dst, d.pending, last)
+	d.crc = d.enc.updateChecksum(d.crc, dst[:n])
+
+	return n, reason
+}
+
+// hold makes r the pending character, which is decoded by the next flush
+// after finding whether it is the last.
+func (d *charDecoder) hold(r rune) {
+	d.pending, d.hasPending = r, true
+}
+
+// decodeBlock decodes the full block of the indexes into dst. There must be
+// no pending character and the state must be aligned.
+func (d *charDecoder) decodeBlock(dst []byte, index *[charsPerBlock]uint16) {
+	decodeBlock(dst, index)
+	d.crc = d.enc.updateChecksum(d.crc, dst[:bytesPerBlock])
+}
+
+// tooLarge reports whether n decoded bytes, including the checksum, exceed
+// the limit.
+func (d *charDecoder) tooLarge(n int) bool {
+	return d.enc.tooLarge(n - d.enc.checksumLen())
+}
+
+// finish returns the length of all the n decoded bytes without
+// the checksum, and ErrChecksum or ErrTooLarge if they are not valid.
+// The length is cut back to the limit with ErrTooLarge, in the same way as
+// the stream decoder.
+func (d *charDecoder) finish(n int) (int, error) {
+	if d.enc.checksum {
+		var err error
+		if n, err = trimChecksum(n, d.crc); err != nil {
+			return n, err
+		}
+	}
+
+	if d.enc.tooLarge(n) {
+		return d.enc.maxDecodedLen, ErrTooLarge
+	}
+
+	return n, nil
+}
+
+// decodeState holds the bits carried over between decoded characters.
+type decodeState struct {
+	stage     uint32
+	remaining uint8
+	residue   uint8
+}
+
+// aligned reports whether st is at the boundary of blocks.
+func (st *decodeState) aligned() bool {
+	return st.remaining == 0 && st.residue == 0
+}
+
+// lookupBlock stores the indexes of the first 8 characters of src into index.
+// It returns false if src has less than 8 characters or any of them is not
+// a character of the encoder, or if enc is constant time.
+func (enc *Encoding) lookupBlock(index *[charsPerBlock]uint16, src []rune) bool {
+	if enc.constantTime || len(src) < charsPerBlock {
+		return false
+	}
+
+	for k := range index {
+		index[k] = enc.lookup(src[k])
+		if index[k] >= tailOffset {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookupBlockUTF8 is like lookupBlock but reads UTF-8 encoded src. It returns
+// the length in bytes of the 8 characters, or 0 if they are not available.
+func (enc *Encoding) lookupBlockUTF8(index *[charsPerBlock]uint16, src []byte) int {
+	if enc.constantTime {
+		return 0
+	}
+
+	n := 0
+
+	for k := range index {
+		r, size := utf8.DecodeRune(src[n:])
+		if size == 0 {
+			return 0
+		}
+
+		index[k] = enc.lookup(r)
+		if index[k] >= tailOffset {
+			return 0
+		}
+
+		n += size
+	}
+
+	return n
+}
+
+// lookupBlockString is like lookupBlockUTF8 but takes the string s.
+func (enc *Encoding) lookupBlockString(index *[charsPerBlock]uint16, s string) int {
+	if enc.constantTime {
+		return 0
+	}
+
+	// Range over s, which decodes UTF-8 faster than utf8.DecodeRuneInString.
+	k := 0
+
+	for n, r := range s {
+		if k == charsPerBlock {
+			return n
+		}
+
+		index[k] = enc.lookup(r)
+		if index[k] >= tailOffset {
+			return 0
+		}
+
+		k++
+	}
+
+	if k < charsPerBlock {
+		return 0
+	}
+
+	return len(s)
+}
+
+// decodeChar adds the bits of the character r to the state st, and writes
+// the completed bytes to dst. The last must be true if r is the last
+// character of the input. It returns the number of bytes written, and
+// the reason if r is not allowed at this position.
+func (enc *Encoding) decodeChar(st *decodeState, dst []byte, r rune, last bool) (n int, reason Reason) {
+	st.residue = (st.residue + bitsPerChar) % bitsPerByte
+
+	var (
+		newBits      = enc.lookupChar(r)
+		newBitsCount uint8
+	)
+
+	switch {
+	case newBits < tailOffset:
+		if last {
+			newBitsCount = bitsPerChar - st.residue
+
+			// The unused bits of the last character must be zero.
+			if enc.strict && newBits >= (1<<newBitsCount) {
+				return 0, ReasonNonCanonical
 			}
 		} else {
-			newBitsCount = bitsPerByte - remaining
-			newBits, ok = enc.tailMap[src[si]]
-			if !ok || si < se || newBits >= (1<<newBitsCount) {
-				return n, CorruptInputError(si)
+			newBitsCount = bitsPerChar
+		}
+	case newBits != invalidIndex:
+		newBits -= tailOffset
+		newBitsCount = bitsPerByte - st.remaining
+
+		switch {
+		case !last:
+			return 0, ReasonTailNotLast
+		case newBits >= (1 << newBitsCount):
+			return 0, ReasonTailOutOfRange
+		case enc.strict && newBitsCount > bitsPerChar-bitsPerByte:
+			// The encoder uses the trailing character only for 1 to 3 bits.
+			return 0, ReasonNonCanonical
+		}
+	default:
+		return 0, ReasonInvalidCharacter
+	}
+
+	st.stage = (st.stage << newBitsCount) | uint32(newBits)
+	st.remaining += newBitsCount
+
+	for st.remaining >= bitsPerByte {
+		st.remaining -= bitsPerByte
+		dst[n] = byte(st.stage >> st.remaining)
+		st.stage &= (1 << st.remaining) - 1
+		n++
+	}
+
+	return n, 0
+}
+
+// DecodeString returns the bytes represented by the base2048 string s.
+func (enc *Encoding) DecodeString(s string) ([]byte, error) {
+	// The number of characters gives an upper bound of the length including
+	// the checksum. Count the exact length only if the bound is too large,
+	// since it decodes the whole UTF-8 input once more.
+	n := saturatedDecodedLen(utf8.RuneCountInString(s))
+	if enc.tooLarge(n-enc.checksumLen()) || n == maxInt {
+		exact := enc.DecodedLenExactString(s)
+		if enc.tooLarge(exact) || exact >= maxInt-enc.checksumLen() {
+			return nil, ErrTooLarge
+		}
+
+		// Make room for the checksum, which is decoded before being removed.
+		n = exact + enc.checksumLen()
+	}
+
+	dst, _, err := enc.appendDecodeString(make([]byte, 0, n), s, false)
+
+	return dst, err
+}
+
+// AppendDecode appends the base2048 decoded src, which is UTF-8 encoded,
+// to dst and returns the extended buffer. If src contains invalid base2048
+// data, it will return the bytes successfully decoded and *DecodeError.
+// New line characters (\r and \n) and the characters set by WithIgnore are
+// ignored, and the line prefix of the encoding is stripped from the start of
+// each line, unless the encoding is strict.
+func (enc *Encoding) AppendDecode(dst, src []byte) ([]byte, error) {
+	dst, _, err := enc.appendDecode(dst, src, false)
+
+	return dst, err
+}
+
+// Valid reports whether the string s is valid base2048 data, with the same
+// checks as DecodeString but without allocating the decoded bytes. It returns
+// the exact length in bytes of the decoded data, or the number of bytes
+// decoded before the illegal data and *DecodeError.
+func (enc *Encoding) Valid(s string) (int, error) {
+	_, n, err := enc.appendDecodeString(nil, s, true)
+
+	return n, err
+}
+
+// appendDecode appends the decoded src to dst, and returns the extended
+// buffer and the number of decoded bytes. If discard is true, the decoded
+// bytes are counted but not appended.
+func (enc *Encoding) appendDecode(dst, src []byte, discard bool) ([]byte, int, error) {
+	var (
+		d         = newCharDecoder(enc)
+		n         int
+		pendingAt int // byte offset of the pending character
+		buf       [bytesPerBlock]byte
+		index     [charsPerBlock]uint16
+	)
+
+	// output appends the decoded bytes b to dst unless discard is true.
+	output := func(b []byte) {
+		if !discard {
+			dst = append(dst, b...)
+		}
+
+		n += len(b)
+	}
+
+	for si := 0; si < len(src); {
+		if d.tooLarge(n) {
+			if !discard {
+				dst = dst[:len(dst)-(n-enc.maxDecodedLen)]
 			}
+
+			return dst, enc.maxDecodedLen, ErrTooLarge
 		}
 
-		stage = (stage << newBitsCount) | uint32(newBits)
-		remaining += newBitsCount
+		if d.atLineStart() {
+			if size := enc.linePrefixLen(src[si:]); size > 0 {
+				d.endLineStart()
+				si += size
 
-		for remaining >= bitsPerByte {
-			remaining -= bitsPerByte
-			dst[n] = byte(stage >> remaining)
-			stage &= (1 << remaining) - 1
-			n++
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRune(src[si:])
+
+		if d.skip(r) {
+			si += size
+
+			continue
+		}
+
+		written, reason := d.flush(buf[:], false)
+		output(buf[:written])
+
+		if reason != 0 {
+			return dst, n, decodeError(bytesPosition(src, pendingAt), d.pending, reason)
+		}
+
+		if r == utf8.RuneError && !utf8.FullRune(src[si:]) {
+			return dst, n, decodeError(bytesPosition(src, si), r, ReasonTruncated)
+		}
+
+		// Decode a full block with fixed shifts.
+		if d.st.aligned() {
+			if size := enc.lookupBlockUTF8(&index, src[si:]); size > 0 {
+				d.decodeBlock(buf[:], &index)
+				output(buf[:])
+				si += size
+
+				continue
+			}
 		}
+
+		d.hold(r)
+		pendingAt = si
+		si += size
 	}
 
-	return n, nil
+	written, reason := d.flush(buf[:], true)
+	output(buf[:written])
+
+	if reason != 0 {
+		return dst, n, decodeError(bytesPosition(src, pendingAt), d.pending, reason)
+	}
+
+	k, err := d.finish(n)
+	if !discard {
+		dst = dst[:len(dst)-(n-k)]
+	}
+
+	return dst, k, err
 }
 
-// DecodeString returns the bytes represented by the base64 string s.
-func (enc *Encoding) DecodeString(s string) ([]byte, error) {
-	sbuf := []rune(s)
-	dbuf := make([]byte, enc.DecodedLen(len(sbuf)))
-	n, err := enc.Decode(dbuf, sbuf)
+// appendDecodeString is like appendDecode but takes the string s, so that s
+// is not copied into bytes.
+func (enc *Encoding) appendDecodeString(dst []byte, s string, discard bool) ([]byte, int, error) {
+	var (
+		d         = newCharDecoder(enc)
+		n         int
+		pendingAt int // byte offset of the pending character
+		buf       [bytesPerBlock]byte
+		index     [charsPerBlock]uint16
+		prefix    = string(enc.linePrefix)
+	)
+
+	// output appends the decoded bytes b to dst unless discard is true.
+	output := func(b []byte) {
+		if !discard {
+			dst = append(dst, b...)
+		}
+
+		n += len(b)
+	}
+
+	for si := 0; si < len(s); {
+		if d.tooLarge(n) {
+			if !discard {
+				dst = dst[:len(dst)-(n-enc.maxDecodedLen)]
+			}
+
+			return dst, enc.maxDecodedLen, ErrTooLarge
+		}
 
-	return dbuf[:n], err
+		if d.atLineStart() && strings.HasPrefix(s[si:], prefix) {
+			d.endLineStart()
+			si += len(prefix)
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[si:])
+
+		if d.skip(r) {
+			si += size
+
+			continue
+		}
+
+		written, reason := d.flush(buf[:], false)
+		output(buf[:written])
+
+		if reason != 0 {
+			return dst, n, decodeError(stringPosition(s, pendingAt), d.pending, reason)
+		}
+
+		if r == utf8.RuneError && !utf8.FullRuneInString(s[si:]) {
+			return dst, n, decodeError(stringPosition(s, si), r, ReasonTruncated)
+		}
+
+		// Decode a full block with fixed shifts.
+		if d.st.aligned() {
+			if size := enc.lookupBlockString(&index, s[si:]); size > 0 {
+				d.decodeBlock(buf[:], &index)
+				output(buf[:])
+				si += size
+
+				continue
+			}
+		}
+
+		d.hold(r)
+		pendingAt = si
+		si += size
+	}
+
+	written, reason := d.flush(buf[:], true)
+	output(buf[:written])
+
+	if reason != 0 {
+		return dst, n, decodeError(stringPosition(s, pendingAt), d.pending, reason)
+	}
+
+	k, err := d.finish(n)
+	if !discard {
+		dst = dst[:len(dst)-(n-k)]
+	}
+
+	return dst, k, err
+}
+
+// linePrefixLen returns the length in bytes of the line prefix if the UTF-8
+// encoded src begins with it, or 0 otherwise.
+func (enc *Encoding) linePrefixLen(src []byte) int {
+	n := 0
+
+	for _, r := range enc.linePrefix {
+		c, size := utf8.DecodeRune(src[n:])
+		if c != r || size == 0 {
+			return 0
+		}
+
+		n += size
+	}
+
+	return n
 }
 
 // DecodedLen returns the maximum length in bytes of the decoded data
-// corresponding to n characters of base2048-encoded data.
+// corresponding to n characters of base2048-encoded data, including
+// the checksum if the encoding has one. It panics if the result overflows int.
 func (enc *Encoding) DecodedLen(n int) int {
-	return n * bitsPerChar / bitsPerByte
+	// Split n into full blocks and the rest to avoid overflow.
+	return addLen(mulLen(n/charsPerBlock, bytesPerBlock), n%charsPerBlock*bitsPerChar/bitsPerByte)
+}
+
+// saturatedDecodedLen is like DecodedLen but returns maxInt if the result
+// overflows int.
+func saturatedDecodedLen(n int) int {
+	blocks := n / charsPerBlock
+	rest := n % charsPerBlock * bitsPerChar / bitsPerByte
+
+	if blocks > (maxInt-rest)/bytesPerBlock {
+		return maxInt
+	}
+
+	return blocks*bytesPerBlock + rest
+}
+
+// DecodedLenExact returns the length in bytes of the decoded data
+// corresponding to the base2048-encoded src, skipping new line characters
+// and line prefixes in the same way as Decode, and excluding the checksum.
+// The result is exact if src is valid, and otherwise an upper bound of
+// the bytes decoded before the error. It returns the maximum int if
+// the result overflows int.
+func (enc *Encoding) DecodedLenExact(src []rune) int {
+	var (
+		d     = newCharDecoder(enc)
+		chars int
+		last  rune
+	)
+
+	for i := 0; i < len(src); i++ {
+		if d.atLineStart() && enc.hasLinePrefix(src[i:]) {
+			d.endLineStart()
+			i += len(enc.linePrefix) - 1
+
+			continue
+		}
+
+		if d.skip(src[i]) {
+			continue
+		}
+
+		chars++
+		last = src[i]
+	}
+
+	return enc.exactLen(chars, last)
+}
+
+// DecodedLenExactString is like DecodedLenExact but takes the string s.
+func (enc *Encoding) DecodedLenExactString(s string) int {
+	var (
+		d      = newCharDecoder(enc)
+		chars  int
+		last   rune
+		prefix = string(enc.linePrefix)
+	)
+
+	for i := 0; i < len(s); {
+		if d.atLineStart() && strings.HasPrefix(s[i:], prefix) {
+			d.endLineStart()
+			i += len(prefix)
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		if d.skip(r) {
+			i += size
+
+			continue
+		}
+
+		chars++
+		last = r
+		i += size
+	}
+
+	return enc.exactLen(chars, last)
+}
+
+// exactLen returns the length in bytes of the decoded data of chars
+// characters, where last is the last character, excluding the checksum.
+// It returns maxInt if the length overflows int, so that hostile input is
+// rejected by the limit instead of panicking.
+func (enc *Encoding) exactLen(chars int, last rune) int {
+	if chars == 0 {
+		return 0
+	}
+
+	n := saturatedDecodedLen(chars)
+
+	// The trailing character completes the last byte.
+	if v := enc.lookupChar(last); v >= tailOffset && v != invalidIndex {
+		if n = saturatedDecodedLen(chars - 1); n < maxInt {
+			n++
+		}
+	}
+
+	if n < enc.checksumLen() {
+		return 0
+	}
+
+	return n - enc.checksumLen()
+}
+
+// runesLen returns the number of bytes required to encode the runes as UTF-8.
+func runesLen(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		n += utf8.RuneLen(r)
+	}
+
+	return n
+}
+
+// appendRunes appends the UTF-8 encoding of runes to the end of dst.
+func appendRunes(dst []byte, runes []rune) []byte {
+	for _, r := range runes {
+		dst = appendRune(dst, r)
+	}
+
+	return dst
+}
+
+// appendRune appends the UTF-8 encoding of r to the end of dst.
+func appendRune(dst []byte, r rune) []byte {
+	if uint32(r) < utf8.RuneSelf {
+		return append(dst, byte(r))
+	}
+
+	n := len(dst)
+	if cap(dst)-n < utf8.UTFMax {
+		dst = append(dst, make([]byte, utf8.UTFMax)...)
+	}
+
+	return dst[:n+utf8.EncodeRune(dst[n:n+utf8.UTFMax], r)]
 }
@@ -1,9 +1,15 @@
 package base2048
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 type testset struct {
@@ -149,6 +155,57 @@ func TestNewEncodingWithTrailingContainsCLRF(t *testing.T) {
 	}
 }
 
+func TestNewEncodingWithInvalidCharacters(t *testing.T) {
+	testsets := []struct {
+		encoder  map[int]rune
+		trailing map[int]rune
+		want     string
+	}{
+		{map[int]rune{5: 0xD800}, nil, "encoder contains invalid character U+D800 at 5"},
+		{map[int]rune{6: 0xFFFD}, nil, "encoder contains invalid character U+FFFD at 6"},
+		{map[int]rune{7: 0x110000}, nil, "encoder contains invalid character U+110000 at 7"},
+		{map[int]rune{8: -1}, nil, "encoder contains invalid character U+FFFFFFFFFFFFFFFF at 8"},
+		{map[int]rune{9: DefaultEncodeChars[2]}, nil, "encoder contains duplicate character U+014A at 9"},
+		{nil, map[int]rune{1: 0xDFFF}, "trailing contains invalid character U+DFFF at 1"},
+		{nil, map[int]rune{2: DefaultEncodeChars[3]}, "trailing contains encoder character U+014B at 2"},
+		{nil, map[int]rune{7: DefaultTrailingChars[0]}, "trailing contains duplicate character U+0F0D at 7"},
+	}
+
+	for _, p := range testsets {
+		encoder := make([]rune, 2048)
+		copy(encoder, DefaultEncodeChars)
+
+		for i, r := range p.encoder {
+			encoder[i] = r
+		}
+
+		trailing := make([]rune, 8)
+		copy(trailing, DefaultTrailingChars)
+
+		for i, r := range p.trailing {
+			trailing[i] = r
+		}
+
+		enc, err := NewEncodingE(encoder, trailing)
+		if enc != nil || err == nil || err.Error() != p.want {
+			t.Errorf("NewEncodingE() = %v, error %v, want %q", enc, err, p.want)
+		}
+
+		testPanic(t, func() {
+			NewEncoding(encoder, trailing)
+		}, "NewEncoding() = panic want %q", p.want)
+	}
+}
+
+func TestNewEncodingE(t *testing.T) {
+	enc, err := NewEncodingE(DefaultEncodeChars, DefaultTrailingChars)
+	testEqual(t, "NewEncodingE() = error %v, want %v", err, error(nil))
+	testEqual(t, "EncodeToString() = %q, want %q", enc.EncodeToString([]byte("foo")), "\xD5\x93\xDA\x9D\xE0\xBC\x90")
+
+	_, err = NewEncodingE(DefaultEncodeChars[:2047], DefaultTrailingChars)
+	testEqual(t, "NewEncodingE() = error %v, want %v", err.Error(), "encoder is not 2048 characters")
+}
+
 func TestEncode(t *testing.T) {
 	enc := DefaultEncoding
 
@@ -228,6 +285,58 @@ func TestDecodedLen(t *testing.T) {
 	}
 }
 
+func TestLenOverflow(t *testing.T) {
+	enc := DefaultEncoding
+	maxInt := int(^uint(0) >> 1)
+
+	// ceil(maxInt * 8 / 11)
+	want := new(big.Int).Mul(big.NewInt(int64(maxInt)), big.NewInt(8))
+	want.Add(want, big.NewInt(10)).Quo(want, big.NewInt(11))
+	testEqual(t, "EncodedLen(%d) = %d, want %d", maxInt, enc.EncodedLen(maxInt), int(want.Int64()))
+
+	testEqual(t, "DecodedLen(%d) = %d, want %d", maxInt/11*8, enc.DecodedLen(maxInt/11*8), maxInt/11*11)
+	testPanic(t, func() {
+		enc.DecodedLen(maxInt)
+	}, "DecodedLen() = panic want %q", "length overflows int")
+	testPanic(t, func() {
+		enc.MaxEncodedByteLen(maxInt)
+	}, "MaxEncodedByteLen() = panic want %q", "length overflows int")
+	testPanic(t, func() {
+		enc.WithLineWrap(1, CRLF).EncodedLen(maxInt)
+	}, "EncodedLen() = panic want %q", "length overflows int")
+
+	// The exact length saturates instead, since it is computed from
+	// the input, which can be that long on 32-bit platforms.
+	testEqual(t, "saturatedDecodedLen(%d) = %d, want %d", maxInt/11*8, saturatedDecodedLen(maxInt/11*8), maxInt/11*11)
+	testEqual(t, "saturatedDecodedLen(%d) = %d, want %d", maxInt, saturatedDecodedLen(maxInt), maxInt)
+	testEqual(t, "exactLen(%d) = %d, want %d", maxInt, enc.exactLen(maxInt, enc.encode[0]), maxInt)
+	testEqual(t, "exactLen(%d) = %d, want %d", maxInt, enc.exactLen(maxInt, enc.tail[0]), maxInt)
+	testEqual(t, "exactLen(%d) = %d, want %d", maxInt, enc.WithChecksum().exactLen(maxInt, enc.encode[0]), maxInt-4)
+}
+
+func TestDecodedLenExact(t *testing.T) {
+	encodings := []*Encoding{
+		DefaultEncoding,
+		DefaultEncoding.WithLineWrap(3, CRLF).WithLinePrefix("# "),
+		DefaultEncoding.Strict(),
+	}
+
+	for _, enc := range encodings {
+		data := benchData(30)
+		for n := 0; n <= len(data); n++ {
+			encoded := enc.EncodeToString(data[:n])
+			testEqual(t, "DecodedLenExact(%q) = %v, want %v", encoded, enc.DecodedLenExact([]rune(encoded)), n)
+			testEqual(t, "DecodedLenExactString(%q) = %v, want %v", encoded, enc.DecodedLenExactString(encoded), n)
+		}
+	}
+
+	// An upper bound of the bytes decoded before the error.
+	for _, p := range []string{"Z", "\xD5\x93\xDA\x9DZ", "\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93"} {
+		dbuf, _ := DefaultEncoding.DecodeString(p)
+		testRange(t, "DecodedLenExactString([% X]) = %v, want in range [%v, %v]", p, DefaultEncoding.DecodedLenExactString(p), len(dbuf), DefaultEncoding.DecodedLen(len(p)))
+	}
+}
+
 func TestDecodeError(t *testing.T) {
 	testerrors := []struct {
 		decoded, encoded string
@@ -253,7 +362,7 @@ func TestDecodeError(t *testing.T) {
 		dbuf, err := enc.DecodeString(p.encoded)
 		want := CorruptInputError(p.pos)
 
-		if !reflect.DeepEqual(want, err) {
+		if !reflect.DeepEqual(want, asPositionError(err)) {
 			t.Errorf("DecodeString([% X]) = error %v, want %v", p.encoded, err, want)
 		}
 
@@ -333,3 +442,809 @@ func TestEncodeDecodeMatches(t *testing.T) {
 		testEqual(t, "Decode(Encode()) = [% X], want [% X]", string(decoded), string(in))
 	}
 }
+
+func TestWithLineWrap(t *testing.T) {
+	input := []byte("foobarbazqux")
+	runes := []rune(DefaultEncoding.EncodeToString(input))
+	line1, line2, line3 := string(runes[:4]), string(runes[4:8]), string(runes[8:])
+
+	testsets := []struct {
+		enc     *Encoding
+		encoded string
+	}{
+		{DefaultEncoding.WithLineWrap(0, LF), string(runes)},
+		{DefaultEncoding.WithLineWrap(4, LF), line1 + "\n" + line2 + "\n" + line3},
+		{DefaultEncoding.WithLineWrap(4, CRLF), line1 + "\r\n" + line2 + "\r\n" + line3},
+		{DefaultEncoding.WithLineWrap(11, LF), string(runes)},
+		{DefaultEncoding.WithLineWrap(8, LF), line1 + line2 + "\n" + line3},
+		{DefaultEncoding.WithLinePrefix("# "), "# " + string(runes)},
+		{DefaultEncoding.WithLineWrap(4, LF).WithLinePrefix("// "), "// " + line1 + "\n// " + line2 + "\n// " + line3},
+		{DefaultEncoding.WithLinePrefix("// ").WithLineWrap(4, CRLF), "// " + line1 + "\r\n// " + line2 + "\r\n// " + line3},
+	}
+
+	for _, p := range testsets {
+		got := p.enc.EncodeToString(input)
+		testEqual(t, "EncodeToString(%q) = %q, want %q", input, got, p.encoded)
+		testEqual(t, "EncodedLen(%d) = %d, want %d", len(input), p.enc.EncodedLen(len(input)), len([]rune(p.encoded)))
+
+		dbuf, err := p.enc.DecodeString(p.encoded)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %q, want %q", p.encoded, string(dbuf), string(input))
+	}
+
+	enc := DefaultEncoding.WithLineWrap(3, LF).WithLinePrefix("# ")
+	testEqual(t, "EncodeToString(%q) = %q, want %q", "", enc.EncodeToString(nil), "")
+	testEqual(t, "EncodedLen(%d) = %d, want %d", 0, enc.EncodedLen(0), 0)
+}
+
+func TestWithLineWrapInvalidLineEnding(t *testing.T) {
+	testPanic(t, func() {
+		DefaultEncoding.WithLineWrap(76, "\r")
+	}, "WithLineWrap() = panic want %q", "invalid line ending")
+}
+
+func TestWithGroups(t *testing.T) {
+	input := []byte("foobarbazqux")
+	runes := []rune(DefaultEncoding.EncodeToString(input))
+	r := func(i, j int) string { return string(runes[i:j]) }
+
+	testsets := []struct {
+		enc     *Encoding
+		encoded string
+	}{
+		{DefaultEncoding.WithGroups(0, ' '), string(runes)},
+		{DefaultEncoding.WithGroups(3, ' '), r(0, 3) + " " + r(3, 6) + " " + r(6, 9)},
+		{DefaultEncoding.WithGroups(4, '-'), r(0, 4) + "-" + r(4, 8) + "-" + r(8, 9)},
+		{DefaultEncoding.WithGroups(9, '-'), string(runes)},
+		{DefaultEncoding.WithGroups(2, ' ').WithLineWrap(5, LF), r(0, 2) + " " + r(2, 4) + " " + r(4, 5) + "\n" + r(5, 7) + " " + r(7, 9)},
+		{DefaultEncoding.WithGroups(2, '\u3000').WithLineWrap(4, CRLF).WithLinePrefix("# "), "# " + r(0, 2) + "\u3000" + r(2, 4) + "\r\n# " + r(4, 6) + "\u3000" + r(6, 8) + "\r\n# " + r(8, 9)},
+	}
+
+	for _, p := range testsets {
+		got := p.enc.EncodeToString(input)
+		testEqual(t, "EncodeToString(%q) = %q, want %q", input, got, p.encoded)
+		testEqual(t, "EncodedLen(%d) = %d, want %d", len(input), p.enc.EncodedLen(len(input)), len([]rune(p.encoded)))
+		testEqual(t, "EncodedByteLen(%q) = %d, want %d", input, p.enc.EncodedByteLen(input), len(p.encoded))
+
+		rbuf := make([]rune, p.enc.EncodedLen(len(input)))
+		p.enc.Encode(rbuf, input)
+		testEqual(t, "Encode(%q) = %q, want %q", input, string(rbuf), p.encoded)
+
+		dbuf, err := p.enc.DecodeString(p.encoded)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %q, want %q", p.encoded, string(dbuf), string(input))
+
+		dbuf, err = ioutil.ReadAll(NewDecoder(p.enc, strings.NewReader(p.encoded)))
+		testEqual(t, "NewDecoder(%q) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "NewDecoder(%q) = %q, want %q", p.encoded, string(dbuf), string(input))
+	}
+
+	// EncodedLen agrees with the output for every length.
+	enc := DefaultEncoding.WithGroups(3, '-').WithLineWrap(7, LF)
+	data := benchData(30)
+
+	for n := 0; n <= len(data); n++ {
+		encoded := enc.EncodeToString(data[:n])
+		testEqual(t, "EncodedLen(%d) = %d, want %d", n, enc.EncodedLen(n), len([]rune(encoded)))
+	}
+
+	// Strict encodings skip no characters, including their own separators.
+	strict := DefaultEncoding.WithGroups(4, '-').Strict()
+	encoded := strict.EncodeToString(input)
+
+	_, err := strict.DecodeString(encoded)
+	testEqual(t, "Strict().DecodeString(%q) = error %v, want %v", encoded, asPositionError(err), error(CorruptInputError(4)))
+
+	dbuf, err := strict.DecodeString(string(runes))
+	testEqual(t, "Strict().DecodeString(%q) = error %v, want %v", string(runes), err, error(nil))
+	testEqual(t, "Strict().DecodeString(%q) = %q, want %q", string(runes), string(dbuf), string(input))
+}
+
+func TestWithGroupsInvalid(t *testing.T) {
+	testPanic(t, func() {
+		DefaultEncoding.WithGroups(4, '\n')
+	}, "WithGroups() = panic want %q", "group separator is newline character")
+
+	testPanic(t, func() {
+		DefaultEncoding.WithGroups(4, DefaultEncodeChars[0])
+	}, "WithGroups() = panic want %q", "group separator is encoding character")
+
+	// U+FFFD would skip invalid UTF-8 on decoding.
+	testPanic(t, func() {
+		DefaultEncoding.WithGroups(2, utf8.RuneError)
+	}, "WithGroups() = panic want %q", "group separator is invalid character")
+
+	testPanic(t, func() {
+		DefaultEncoding.WithGroups(2, -1)
+	}, "WithGroups() = panic want %q", "group separator is invalid character")
+}
+
+func TestWithLinePrefixInvalid(t *testing.T) {
+	testPanic(t, func() {
+		DefaultEncoding.WithLinePrefix("#\n")
+	}, "WithLinePrefix() = panic want %q", "line prefix contains newline character")
+
+	testPanic(t, func() {
+		DefaultEncoding.WithLinePrefix(string(DefaultEncodeChars[100]))
+	}, "WithLinePrefix() = panic want %q", "line prefix contains encoding character")
+
+	testPanic(t, func() {
+		DefaultEncoding.WithLinePrefix(string(DefaultTrailingChars[3]))
+	}, "WithLinePrefix() = panic want %q", "line prefix contains encoding character")
+}
+
+func TestDecodeWithLinePrefix(t *testing.T) {
+	enc := DefaultEncoding.WithLinePrefix("# ")
+	testsets := []struct {
+		decoded, encoded string
+	}{
+		{"foo", "# \xD5\x93\xDA\x9D\xE0\xBC\x90"},
+		{"foo", "# \xD5\x93\n# \xDA\x9D\xE0\xBC\x90\n"},
+		{"foo", "# \xD5\x93\r\n\xDA\x9D\r\n# \xE0\xBC\x90\r\n# "},
+		{"foo", "\xD5\x93\xDA\x9D\xE0\xBC\x90"},
+	}
+
+	for _, p := range testsets {
+		dbuf, err := enc.DecodeString(p.encoded)
+		testEqual(t, "DecodeString([% X]) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "DecodeString([% X]) = %q, want %q", p.encoded, string(dbuf), p.decoded)
+	}
+
+	// The prefix is only stripped from the start of a line.
+	_, err := enc.DecodeString("\xD5\x93# \xDA\x9D\xE0\xBC\x90")
+	testEqual(t, "DecodeString() = error %v, want %v", asPositionError(err), error(CorruptInputError(1)))
+}
+
+func TestAppendEncode(t *testing.T) {
+	enc := DefaultEncoding
+
+	for _, p := range testsets {
+		got := enc.AppendEncode([]byte("prefix:"), []byte(p.decoded))
+		testEqual(t, "AppendEncode(%q) = [% X], want [% X]", p.decoded, string(got), "prefix:"+p.encoded)
+	}
+}
+
+func TestAppendDecode(t *testing.T) {
+	enc := DefaultEncoding
+
+	for _, p := range testsets {
+		got, err := enc.AppendDecode([]byte("prefix:"), []byte(p.encoded))
+		testEqual(t, "AppendDecode([% X]) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "AppendDecode([% X]) = %q, want %q", p.encoded, string(got), "prefix:"+p.decoded)
+	}
+}
+
+func TestAppendDecodeError(t *testing.T) {
+	enc := DefaultEncoding
+	testerrors := []struct {
+		decoded, encoded string
+		pos              int64
+	}{
+		{"", "Z", 0},
+		{"fooba", "\xD5\x93\xDA\x9D\xE0\xB6\xAA\xE0\xB0\xA8Z\xC5\x8A", 4},
+		{"fo", "\xD5\x93\n\xDA\x9DZ", 3},
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93", 2},
+		// invalid UTF-8
+		{"f", "\xD5\x93\xDA", 1},
+	}
+
+	for _, p := range testerrors {
+		dbuf, err := enc.AppendDecode(nil, []byte(p.encoded))
+		testEqual(t, "AppendDecode([% X]) = error %v, want %v", p.encoded, asPositionError(err), error(CorruptInputError(p.pos)))
+		testEqual(t, "AppendDecode([% X]) = %q, want %q", p.encoded, string(dbuf), p.decoded)
+	}
+}
+
+func TestAppendAllocs(t *testing.T) {
+	enc := DefaultEncoding
+	input := []byte("foobarbazqux")
+	ebuf := enc.AppendEncode(nil, input)
+	dbuf := make([]byte, 0, len(input))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ebuf = enc.AppendEncode(ebuf[:0], input)
+		dbuf, _ = enc.AppendDecode(dbuf[:0], ebuf)
+	})
+	testEqual(t, "AppendEncode/AppendDecode allocs = %v, want %v", allocs, float64(0))
+}
+
+func TestEncodedByteLen(t *testing.T) {
+	encodings := []*Encoding{
+		DefaultEncoding,
+		DefaultEncoding.WithLineWrap(3, CRLF).WithLinePrefix("# "),
+	}
+
+	for _, enc := range encodings {
+		for _, p := range testsets {
+			want := len(enc.EncodeToString([]byte(p.decoded)))
+			got := enc.EncodedByteLen([]byte(p.decoded))
+			testEqual(t, "EncodedByteLen(%q) = %d, want %d", p.decoded, got, want)
+
+			got = enc.MaxEncodedByteLen(len(p.decoded))
+			testRange(t, "MaxEncodedByteLen(%d) = %d, want between %d and %d", len(p.decoded), got, want, enc.EncodedLen(len(p.decoded))*3)
+		}
+	}
+}
+
+func TestMaxEncodedByteLen(t *testing.T) {
+	encoder := make([]rune, 2048)
+	copy(encoder, DefaultEncodeChars)
+	encoder[1] = 0x1F600 // 4 bytes in UTF-8
+	enc := NewEncoding(encoder, DefaultTrailingChars)
+
+	testEqual(t, "MaxEncodedByteLen(%d) = %d, want %d", 11, enc.MaxEncodedByteLen(11), 32)
+	testEqual(t, "MaxEncodedByteLen(%d) = %d, want %d", 11, DefaultEncoding.MaxEncodedByteLen(11), 24)
+	testEqual(t, "MaxEncodedByteLen(%d) = %d, want %d", 0, DefaultEncoding.MaxEncodedByteLen(0), 0)
+}
+
+func TestEncodeDecodeBlocks(t *testing.T) {
+	enc := DefaultEncoding
+	data := benchData(50)
+
+	for n := 0; n <= len(data); n++ {
+		in := data[:n]
+
+		want := make([]rune, enc.EncodedLen(n))
+		referenceEncode(enc, want, in)
+		encoded := string(want)
+
+		rbuf := make([]rune, enc.EncodedLen(n))
+		enc.Encode(rbuf, in)
+		testEqual(t, "Encode(%x) = %q, want %q", in, string(rbuf), encoded)
+		testEqual(t, "EncodeToString(%x) = %q, want %q", in, enc.EncodeToString(in), encoded)
+
+		dbuf := make([]byte, enc.DecodedLen(len(rbuf)))
+		count := referenceDecode(enc, dbuf, rbuf)
+		testEqual(t, "referenceDecode(%q) = %x, want %x", encoded, string(dbuf[:count]), string(in))
+
+		count, err := enc.Decode(dbuf, rbuf)
+		testEqual(t, "Decode(%q) = error %v, want %v", encoded, err, error(nil))
+		testEqual(t, "Decode(%q) = %x, want %x", encoded, string(dbuf[:count]), string(in))
+
+		decoded, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", encoded, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %x, want %x", encoded, string(decoded), string(in))
+
+		// Newlines inside blocks make the decoder fall back to the bitwise path.
+		wrapped := DefaultEncoding.WithLineWrap(3, LF).EncodeToString(in)
+		decoded, err = enc.DecodeString(wrapped)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", wrapped, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %x, want %x", wrapped, string(decoded), string(in))
+	}
+}
+
+// referenceEncode encodes src into dst bit by bit, in the way of the former
+// implementation without the block path.
+func referenceEncode(enc *Encoding, dst []rune, src []byte) {
+	var (
+		acc  uint32
+		bits uint
+		di   int
+	)
+
+	for _, c := range src {
+		acc = acc<<bitsPerByte | uint32(c)
+		bits += bitsPerByte
+
+		if bits >= bitsPerChar {
+			bits -= bitsPerChar
+			dst[di] = enc.encode[acc>>bits]
+			di++
+			acc &= 1<<bits - 1
+		}
+	}
+
+	switch {
+	case bits == 0:
+	case bits <= bitsPerChar-bitsPerByte:
+		dst[di] = enc.tail[acc]
+	default:
+		dst[di] = enc.encode[acc]
+	}
+}
+
+// referenceDecode decodes the valid src into dst bit by bit, in the way of
+// the former implementation without the block path, and returns the number
+// of bytes written.
+func referenceDecode(enc *Encoding, dst []byte, src []rune) int {
+	var (
+		acc  uint32
+		bits uint
+		n    int
+	)
+
+	for i, r := range src {
+		v := uint32(enc.lookup(r))
+		size := uint(bitsPerChar)
+
+		switch {
+		case v >= tailOffset:
+			// The trailing character completes the last byte.
+			v -= tailOffset
+			size = bitsPerByte - bits
+		case i == len(src)-1:
+			// The last character has the bits to complete the last byte.
+			size = bitsPerByte - bits
+			if size <= bitsPerChar-bitsPerByte {
+				size += bitsPerByte
+			}
+		}
+
+		acc = acc<<size | v
+		bits += size
+
+		for bits >= bitsPerByte {
+			bits -= bitsPerByte
+			dst[n] = byte(acc >> bits)
+			n++
+		}
+
+		acc &= 1<<bits - 1
+	}
+
+	return n
+}
+
+// decodeMaps returns the maps from the characters of enc to their indexes,
+// used by the former implementation instead of the decode table.
+func decodeMaps(enc *Encoding) (decodeMap, tailMap map[rune]uint16) {
+	decodeMap = make(map[rune]uint16, len(enc.encode))
+	for i, r := range enc.encode {
+		decodeMap[r] = uint16(i)
+	}
+
+	tailMap = make(map[rune]uint16, len(enc.tail))
+	for i, r := range enc.tail {
+		tailMap[r] = uint16(i)
+	}
+
+	return decodeMap, tailMap
+}
+
+// mapDecode decodes the valid src into dst with the maps, in the way of
+// the former implementation, and returns the number of bytes written.
+func mapDecode(decodeMap, tailMap map[rune]uint16, dst []byte, src []rune) int {
+	var (
+		stage     uint32
+		remaining uint8
+		residue   uint8
+		n         int
+	)
+
+	for si, r := range src {
+		residue = (residue + bitsPerChar) % bitsPerByte
+
+		var newBitsCount uint8
+
+		newBits, ok := decodeMap[r]
+		if ok {
+			if si == len(src)-1 {
+				newBitsCount = bitsPerChar - residue
+			} else {
+				newBitsCount = bitsPerChar
+			}
+		} else {
+			newBitsCount = bitsPerByte - remaining
+			newBits = tailMap[r]
+		}
+
+		stage = (stage << newBitsCount) | uint32(newBits)
+		remaining += newBitsCount
+
+		for remaining >= bitsPerByte {
+			remaining -= bitsPerByte
+			dst[n] = byte(stage >> remaining)
+			stage &= (1 << remaining) - 1
+			n++
+		}
+	}
+
+	return n
+}
+
+// mapDecodeString decodes the valid s with the maps, in the way of the former
+// implementation.
+func mapDecodeString(decodeMap, tailMap map[rune]uint16, s string) []byte {
+	sbuf := []rune(s)
+	dbuf := make([]byte, DefaultEncoding.DecodedLen(len(sbuf)))
+
+	return dbuf[:mapDecode(decodeMap, tailMap, dbuf, sbuf)]
+}
+
+func TestMapDecode(t *testing.T) {
+	decodeMap, tailMap := decodeMaps(DefaultEncoding)
+	data := benchData(30)
+
+	for n := 0; n <= len(data); n++ {
+		encoded := DefaultEncoding.EncodeToString(data[:n])
+		got := mapDecodeString(decodeMap, tailMap, encoded)
+		testEqual(t, "mapDecodeString(%q) = %x, want %x", encoded, string(got), string(data[:n]))
+	}
+}
+
+func TestStrict(t *testing.T) {
+	enc := DefaultEncoding.Strict()
+
+	for _, p := range testsets {
+		dbuf, err := enc.DecodeString(p.encoded)
+		testEqual(t, "DecodeString([% X]) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "DecodeString([% X]) = %q, want %q", p.encoded, string(dbuf), p.decoded)
+	}
+
+	data := benchData(30)
+	for n := 0; n <= len(data); n++ {
+		encoded := enc.EncodeToString(data[:n])
+		dbuf, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString(%q) = error %v, want %v", encoded, err, error(nil))
+		testEqual(t, "DecodeString(%q) = %x, want %x", encoded, string(dbuf), string(data[:n]))
+	}
+}
+
+func TestStrictDecodeError(t *testing.T) {
+	enc := DefaultEncoding.Strict()
+	testerrors := []struct {
+		encoded string
+		want    error
+	}{
+		// newline characters
+		{"\r\xD5\x93\xDA\x9D\xE0\xBC\x90", CorruptInputError(0)},
+		{"\xD5\x93\n\xDA\x9D\xE0\xBC\x90", CorruptInputError(1)},
+		{"\xD5\x93\xDA\x9D\xD7\x93\r\n", CorruptInputError(3)},
+		// the last character with non-zero unused bits
+		{string(DefaultEncodeChars[0x100+'f']), NonCanonicalError(0)},
+		// the trailing character for more than 3 bits
+		{string(DefaultEncodeChars[0]) + string(DefaultTrailingChars[0]), NonCanonicalError(1)},
+	}
+
+	for _, p := range testerrors {
+		_, err := DefaultEncoding.DecodeString(p.encoded)
+		testEqual(t, "DecodeString([% X]) = error %v, want %v", p.encoded, err, error(nil))
+
+		_, err = enc.DecodeString(p.encoded)
+		testEqual(t, "Strict().DecodeString([% X]) = error %v, want %v", p.encoded, asPositionError(err), p.want)
+
+		// Every error is a CorruptInputError at the same position.
+		var corrupt CorruptInputError
+		if !errors.As(err, &corrupt) {
+			t.Errorf("Strict().DecodeString([% X]) = error %v, want CorruptInputError", p.encoded, err)
+		}
+
+		testEqual(t, "Strict().DecodeString([% X]) = error %v, want %v", p.encoded,
+			error(corrupt), error(CorruptInputError(positionOf(p.want))))
+
+		dbuf := make([]byte, enc.DecodedLen(len(p.encoded)))
+		_, err = enc.Decode(dbuf, []rune(p.encoded))
+		testEqual(t, "Strict().Decode([% X]) = error %v, want %v", p.encoded, asPositionError(err), p.want)
+
+		_, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(p.encoded)))
+		testEqual(t, "Strict() NewDecoder([% X]) = error %v, want %v", p.encoded, asPositionError(err), p.want)
+	}
+
+	// Line prefixes are not stripped.
+	_, err := DefaultEncoding.WithLinePrefix("#").Strict().DecodeString("#\xD5\x93")
+	testEqual(t, "DecodeString() = error %v, want %v", asPositionError(err), error(CorruptInputError(0)))
+}
+
+// positionOf returns the position of CorruptInputError or NonCanonicalError.
+func positionOf(err error) int64 {
+	switch e := err.(type) {
+	case CorruptInputError:
+		return int64(e)
+	case NonCanonicalError:
+		return int64(e)
+	}
+
+	return -1
+}
+
+func TestValid(t *testing.T) {
+	encodings := []*Encoding{
+		DefaultEncoding,
+		DefaultEncoding.WithLineWrap(3, CRLF).WithLinePrefix("# "),
+	}
+
+	for _, enc := range encodings {
+		data := benchData(30)
+		for n := 0; n <= len(data); n++ {
+			encoded := enc.EncodeToString(data[:n])
+
+			got, err := enc.Valid(encoded)
+			testEqual(t, "Valid(%q) = error %v, want %v", encoded, err, error(nil))
+			testEqual(t, "Valid(%q) = %v, want %v", encoded, got, n)
+
+			got, err = enc.ValidRunes([]rune(encoded))
+			testEqual(t, "ValidRunes(%q) = error %v, want %v", encoded, err, error(nil))
+			testEqual(t, "ValidRunes(%q) = %v, want %v", encoded, got, n)
+		}
+	}
+}
+
+func TestValidError(t *testing.T) {
+	enc := DefaultEncoding
+	testerrors := []struct {
+		decoded, encoded string
+		pos              int64
+	}{
+		{"", "Z", 0},
+		{"fooba", "\xD5\x93\xDA\x9D\xE0\xB6\xAA\xE0\xB0\xA8Z\xC5\x8A", 4},
+		{"fo", "\xD5\x93\n\xDA\x9DZ", 3},
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93", 2},
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x91", 2},
+	}
+
+	for _, p := range testerrors {
+		n, err := enc.Valid(p.encoded)
+		testEqual(t, "Valid([% X]) = error %v, want %v", p.encoded, asPositionError(err), error(CorruptInputError(p.pos)))
+		testEqual(t, "Valid([% X]) = %v, want %v", p.encoded, n, len(p.decoded))
+
+		n, err = enc.ValidRunes([]rune(p.encoded))
+		testEqual(t, "ValidRunes([% X]) = error %v, want %v", p.encoded, asPositionError(err), error(CorruptInputError(p.pos)))
+		testEqual(t, "ValidRunes([% X]) = %v, want %v", p.encoded, n, len(p.decoded))
+	}
+
+	_, err := enc.Strict().Valid(string(DefaultEncodeChars[0x100+'f']))
+	testEqual(t, "Strict().Valid() = error %v, want %v", asPositionError(err), error(NonCanonicalError(0)))
+}
+
+func TestWithMaxDecodedLen(t *testing.T) {
+	data := benchData(30)
+	encoded := DefaultEncoding.EncodeToString(data)
+
+	for _, max := range []int{0, 30, 31} {
+		enc := DefaultEncoding.WithMaxDecodedLen(max)
+
+		dbuf, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString() = error %v, want %v", err, error(nil))
+		testEqual(t, "DecodeString() = %x, want %x", string(dbuf), string(data))
+
+		n, err := enc.Valid(encoded)
+		testEqual(t, "Valid() = error %v, want %v", err, error(nil))
+		testEqual(t, "Valid() = %v, want %v", n, len(data))
+	}
+
+	// Line breaks make the number of characters exceed the limit, but only
+	// the exact length is checked against it.
+	wrapped := DefaultEncoding.WithLineWrap(2, CRLF).WithMaxDecodedLen(len(data))
+	encodedWrapped := wrapped.EncodeToString(data)
+
+	dbuf, err := wrapped.DecodeString(encodedWrapped)
+	testEqual(t, "DecodeString(%q) = error %v, want %v", encodedWrapped, err, error(nil))
+	testEqual(t, "DecodeString(%q) = %x, want %x", encodedWrapped, string(dbuf), string(data))
+
+	// All the decoders return the bytes up to the limit, even if the limit is
+	// in the middle of a block.
+	for _, max := range []int{1, 5, 11, 12, 29} {
+		enc := DefaultEncoding.WithMaxDecodedLen(max)
+
+		dbuf, err := enc.DecodeString(encoded)
+		testEqual(t, "DecodeString() = error %v, want %v", err, ErrTooLarge)
+		testEqual(t, "DecodeString() = %v, want %v", len(dbuf), 0)
+
+		dbuf, err = enc.AppendDecode([]byte("x"), []byte(encoded))
+		testEqual(t, "AppendDecode() = error %v, want %v", err, ErrTooLarge)
+		testEqual(t, "AppendDecode() = %x, want %x", string(dbuf), "x"+string(data[:max]))
+
+		dbuf = make([]byte, len(data))
+		n, err := enc.Decode(dbuf, []rune(encoded))
+		testEqual(t, "Decode() = error %v, want %v", err, ErrTooLarge)
+		testEqual(t, "Decode() = %x, want %x", string(dbuf[:n]), string(data[:max]))
+
+		n, err = enc.Valid(encoded)
+		testEqual(t, "Valid() = error %v, want %v", err, ErrTooLarge)
+		testEqual(t, "Valid() = %v, want %v", n, max)
+
+		n, err = enc.ValidRunes([]rune(encoded))
+		testEqual(t, "ValidRunes() = error %v, want %v", err, ErrTooLarge)
+		testEqual(t, "ValidRunes() = %v, want %v", n, max)
+
+		dbuf, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(encoded)))
+		testEqual(t, "NewDecoder() = error %v, want %v", err, ErrTooLarge)
+
+		if !bytes.Equal(dbuf, data[:max]) {
+			t.Errorf("NewDecoder() = %x, want %x", dbuf, data[:max])
+		}
+	}
+}
+
+func TestWithIgnore(t *testing.T) {
+	enc := DefaultEncoding.WithIgnore(IgnoreSpaces).WithLinePrefix("# ")
+	data := []byte("foobarbazqux")
+	runes := []rune(DefaultEncoding.EncodeToString(data))
+	pasted := "\ufeff# " + string(runes[:2]) + " \t" + string(runes[2:4]) + "\u00a0\u200b\r\n" +
+		"# " + string(runes[4:6]) + "\u200e\u2067" + string(runes[6:]) + " \n"
+
+	dbuf, err := enc.DecodeString(pasted)
+	testEqual(t, "DecodeString(%q) = error %v, want %v", pasted, err, error(nil))
+	testEqual(t, "DecodeString(%q) = %q, want %q", pasted, string(dbuf), string(data))
+
+	dbuf = make([]byte, len(data))
+	n, err := enc.Decode(dbuf, []rune(pasted))
+	testEqual(t, "Decode(%q) = error %v, want %v", pasted, err, error(nil))
+	testEqual(t, "Decode(%q) = %q, want %q", pasted, string(dbuf[:n]), string(data))
+
+	n, err = enc.Valid(pasted)
+	testEqual(t, "Valid(%q) = error %v, want %v", pasted, err, error(nil))
+	testEqual(t, "Valid(%q) = %v, want %v", pasted, n, len(data))
+	testEqual(t, "DecodedLenExact(%q) = %v, want %v", pasted, enc.DecodedLenExact([]rune(pasted)), len(data))
+
+	dbuf, err = ioutil.ReadAll(NewDecoder(enc, strings.NewReader(pasted)))
+	testEqual(t, "NewDecoder(%q) = error %v, want %v", pasted, err, error(nil))
+	testEqual(t, "NewDecoder(%q) = %q, want %q", pasted, string(dbuf), string(data))
+
+	// Error positions count the skipped characters.
+	_, err = enc.DecodeString(" \u200bZ")
+	testEqual(t, "DecodeString() = error %v, want %v", asPositionError(err), error(CorruptInputError(2)))
+
+	// Strict encodings skip no characters.
+	_, err = enc.Strict().DecodeString(string(runes[:2]) + " ")
+	testEqual(t, "Strict().DecodeString() = error %v, want %v", asPositionError(err), error(CorruptInputError(2)))
+
+	// Newlines are still ignored without the ignore set.
+	_, err = enc.WithIgnore(nil).DecodeString(pasted)
+	testEqual(t, "WithIgnore(nil).DecodeString() = error %v, want %v", asPositionError(err), error(CorruptInputError(0)))
+}
+
+func TestWithIgnoreInvalid(t *testing.T) {
+	testPanic(t, func() {
+		DefaultEncoding.WithIgnore(func(r rune) bool { return r == DefaultEncodeChars[100] })
+	}, "WithIgnore() = panic want %q", "ignore set contains encoding character")
+	testPanic(t, func() {
+		DefaultEncoding.WithIgnore(func(r rune) bool { return r == DefaultTrailingChars[7] })
+	}, "WithIgnore() = panic want %q", "ignore set contains encoding character")
+}
+
+// benchData returns n bytes of data for benchmarks.
+func benchData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+
+	return data
+}
+
+func BenchmarkEncode(b *testing.B) {
+	data := benchData(8192)
+	buf := make([]rune, DefaultEncoding.EncodedLen(len(data)))
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		DefaultEncoding.Encode(buf, data)
+	}
+}
+
+func BenchmarkEncodeToString(b *testing.B) {
+	data := benchData(8192)
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		DefaultEncoding.EncodeToString(data)
+	}
+}
+
+// BenchmarkDecode compares Decode with the map based decoder used by
+// the former implementation.
+func BenchmarkDecode(b *testing.B) {
+	data := []rune(DefaultEncoding.EncodeToString(benchData(8192)))
+	buf := make([]byte, DefaultEncoding.DecodedLen(len(data)))
+
+	b.Run("map", func(b *testing.B) {
+		decodeMap, tailMap := decodeMaps(DefaultEncoding)
+
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			mapDecode(decodeMap, tailMap, buf, data)
+		}
+	})
+
+	b.Run("table", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			_, _ = DefaultEncoding.Decode(buf, data)
+		}
+	})
+}
+
+// BenchmarkDecodeString compares DecodeString with the map based decoder
+// used by the former implementation.
+func BenchmarkDecodeString(b *testing.B) {
+	data := DefaultEncoding.EncodeToString(benchData(8192))
+
+	b.Run("map", func(b *testing.B) {
+		decodeMap, tailMap := decodeMaps(DefaultEncoding)
+
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			mapDecodeString(decodeMap, tailMap, data)
+		}
+	})
+
+	b.Run("table", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			_, _ = DefaultEncoding.DecodeString(data)
+		}
+	})
+}
+
+// BenchmarkEncodeBlocks compares the block path of Encode with the bitwise
+// loop used by the former implementation.
+func BenchmarkEncodeBlocks(b *testing.B) {
+	data := benchData(8192)
+	buf := make([]rune, DefaultEncoding.EncodedLen(len(data)))
+
+	b.Run("bitwise", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			referenceEncode(DefaultEncoding, buf, data)
+		}
+	})
+
+	b.Run("block", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			DefaultEncoding.Encode(buf, data)
+		}
+	})
+}
+
+// BenchmarkDecodeBlocks compares the block path of Decode with the bitwise
+// loop used by the former implementation.
+func BenchmarkDecodeBlocks(b *testing.B) {
+	data := []rune(DefaultEncoding.EncodeToString(benchData(8192)))
+	buf := make([]byte, DefaultEncoding.DecodedLen(len(data)))
+
+	b.Run("bitwise", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			referenceDecode(DefaultEncoding, buf, data)
+		}
+	})
+
+	b.Run("block", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			_, _ = DefaultEncoding.Decode(buf, data)
+		}
+	})
+}
+
+// BenchmarkLookup compares the decode table with the map based lookup used
+// by the former implementation.
+func BenchmarkLookup(b *testing.B) {
+	data := []rune(DefaultEncoding.EncodeToString(benchData(8192)))
+
+	b.Run("map", func(b *testing.B) {
+		decodeMap, _ := decodeMaps(DefaultEncoding)
+
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			for _, r := range data {
+				if _, ok := decodeMap[r]; !ok {
+					b.Fatal("not found")
+				}
+			}
+		}
+	})
+
+	b.Run("table", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			for _, r := range data {
+				if DefaultEncoding.lookup(r) == invalidIndex {
+					b.Fatal("not found")
+				}
+			}
+		}
+	})
+}
@@ -1,12 +1,213 @@
 package base2048
 
 import (
+	"errors"
 	"strconv"
+	"unicode/utf8"
 )
 
+// Errors wrapped by DecodeError, which can be tested with errors.Is.
+var (
+	ErrInvalidCharacter = errors.New("base2048: invalid character")
+	ErrTailNotLast      = errors.New("base2048: trailing character not at the end")
+	ErrTailOutOfRange   = errors.New("base2048: trailing character out of range")
+	ErrNonCanonical     = errors.New("base2048: non-canonical character")
+	ErrTruncated        = errors.New("base2048: truncated character")
+)
+
+// ErrTooLarge is returned when the decoded data is longer than the limit set
+// by WithMaxDecodedLen, or when DecodeString finds that the length of
+// the decoded data overflows int.
+var ErrTooLarge = errors.New("base2048: decoded data too large")
+
+// ErrChecksum is returned when the checksum of the encoding set by
+// WithChecksum does not match the decoded data.
+var ErrChecksum = errors.New("base2048: checksum mismatch")
+
 // CorruptInputError represents the position of the illegal data to be decoded.
 type CorruptInputError int64
 
 func (e CorruptInputError) Error() string {
 	return "illegal base2048 data at input " + strconv.FormatInt(int64(e), 10)
 }
+
+// NonCanonicalError represents the position of the non-canonical data to be
+// decoded, which is decoded into the same bytes as another encoded data.
+type NonCanonicalError int64
+
+func (e NonCanonicalError) Error() string {
+	return "non-canonical base2048 data at input " + strconv.FormatInt(int64(e), 10)
+}
+
+// Reason is the reason why a character cannot be decoded.
+type Reason int
+
+const (
+	// ReasonInvalidCharacter means the character is not in the encoding.
+	ReasonInvalidCharacter Reason = iota + 1
+	// ReasonTailNotLast means the trailing character is not at the end.
+	ReasonTailNotLast
+	// ReasonTailOutOfRange means the trailing character has too many bits.
+	ReasonTailOutOfRange
+	// ReasonNonCanonical means the character is not the one the encoder
+	// produces. It is only reported by strict encodings.
+	ReasonNonCanonical
+	// ReasonTruncated means the UTF-8 encoded input ends in the middle of
+	// a character, such as input cut off in transit.
+	ReasonTruncated
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonInvalidCharacter:
+		return "invalid character"
+	case ReasonTailNotLast:
+		return "trailing character not at the end"
+	case ReasonTailOutOfRange:
+		return "trailing character out of range"
+	case ReasonNonCanonical:
+		return "non-canonical character"
+	case ReasonTruncated:
+		return "truncated character"
+	}
+
+	return "Reason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// err returns the error wrapped by DecodeError for the reason.
+func (r Reason) err() error {
+	switch r {
+	case ReasonInvalidCharacter:
+		return ErrInvalidCharacter
+	case ReasonTailNotLast:
+		return ErrTailNotLast
+	case ReasonTailOutOfRange:
+		return ErrTailOutOfRange
+	case ReasonNonCanonical:
+		return ErrNonCanonical
+	case ReasonTruncated:
+		return ErrTruncated
+	}
+
+	return nil
+}
+
+// DecodeError describes the illegal data to be decoded.
+// It can be converted to CorruptInputError with errors.As, and also to
+// NonCanonicalError if Reason is ReasonNonCanonical. It wraps the error for
+// the Reason, such as ErrInvalidCharacter.
+type DecodeError struct {
+	Offset     int64  // index of the character, counting skipped characters
+	ByteOffset int64  // offset of the character in the UTF-8 encoded input
+	Line       int    // line number of the character, starting at 1
+	Column     int    // column of the character in characters, starting at 1
+	Char       rune   // the illegal character
+	Reason     Reason // the reason why the character cannot be decoded
+}
+
+func (e *DecodeError) Error() string {
+	var s string
+	if e.Reason == ReasonNonCanonical {
+		s = NonCanonicalError(e.Offset).Error()
+	} else {
+		s = CorruptInputError(e.Offset).Error()
+	}
+
+	return s + " (line " + strconv.Itoa(e.Line) + ", column " + strconv.Itoa(e.Column) + "): " +
+		e.Reason.String() + " " + strconv.QuoteRune(e.Char)
+}
+
+// Unwrap returns the error for the reason, such as ErrInvalidCharacter.
+func (e *DecodeError) Unwrap() error {
+	return e.Reason.err()
+}
+
+// As converts e to CorruptInputError, or to NonCanonicalError if Reason is
+// ReasonNonCanonical.
+func (e *DecodeError) As(target interface{}) bool {
+	switch t := target.(type) {
+	case *CorruptInputError:
+		*t = CorruptInputError(e.Offset)
+
+		return true
+	case *NonCanonicalError:
+		if e.Reason == ReasonNonCanonical {
+			*t = NonCanonicalError(e.Offset)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// position is the position of a character in the input.
+type position struct {
+	offset     int64
+	byteOffset int64
+	line       int
+	column     int
+}
+
+// startPosition is the position of the first character of the input.
+var startPosition = position{line: 1, column: 1} //nolint:gochecknoglobals
+
+// advance moves p to the next of the character r, which is size bytes long.
+func (p *position) advance(r rune, size int) {
+	p.offset++
+	p.byteOffset += int64(size)
+
+	if r == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+}
+
+// runesPosition returns the position of the i-th character of src.
+func runesPosition(src []rune, i int) position {
+	p := startPosition
+	for _, r := range src[:i] {
+		p.advance(r, len(string(r)))
+	}
+
+	return p
+}
+
+// bytesPosition returns the position of the character at the byte offset i
+// of the UTF-8 encoded src.
+func bytesPosition(src []byte, i int) position {
+	p := startPosition
+	for n := 0; n < i; {
+		r, size := utf8.DecodeRune(src[n:])
+		p.advance(r, size)
+		n += size
+	}
+
+	return p
+}
+
+// stringPosition is like bytesPosition but takes the string s.
+func stringPosition(s string, i int) position {
+	p := startPosition
+	for n := 0; n < i; {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		p.advance(r, size)
+		n += size
+	}
+
+	return p
+}
+
+// decodeError returns the error of the character r at the position p.
+func decodeError(p position, r rune, reason Reason) error {
+	return &DecodeError{
+		Offset:     p.offset,
+		ByteOffset: p.byteOffset,
+		Line:       p.line,
+		Column:     p.column,
+		Char:       r,
+		Reason:     reason,
+	}
+}
@@ -1,9 +1,29 @@
 package base2048
 
 import (
+	"errors"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
+// asPositionError converts the *DecodeError to NonCanonicalError, or
+// CorruptInputError if it is not, to compare with them.
+func asPositionError(err error) error {
+	var nonCanonical NonCanonicalError
+	if errors.As(err, &nonCanonical) {
+		return nonCanonical
+	}
+
+	var corrupt CorruptInputError
+	if errors.As(err, &corrupt) {
+		return corrupt
+	}
+
+	return err
+}
+
 func TestCorruptInputError(t *testing.T) {
 	{
 		err := CorruptInputError(0)
@@ -19,3 +39,131 @@ func TestCorruptInputError(t *testing.T) {
 		testEqual(t, "CorruptInputError(%d) = %q, want %q", 0, got, want)
 	}
 }
+
+func TestNonCanonicalError(t *testing.T) {
+	err := NonCanonicalError(12)
+	got := err.Error()
+	want := "non-canonical base2048 data at input 12"
+	testEqual(t, "NonCanonicalError(%d) = %q, want %q", 12, got, want)
+}
+
+func TestDecodeErrorPosition(t *testing.T) {
+	testsets := []struct {
+		encoded string
+		want    DecodeError
+	}{
+		{"Z", DecodeError{0, 0, 1, 1, 'Z', ReasonInvalidCharacter}},
+		{"\xD5\x93\r\n\xDA\x9DZ", DecodeError{4, 6, 2, 2, 'Z', ReasonInvalidCharacter}},
+		{"\xD5\x93\n\xDA\x9D\n\xE0\xBC\x90\xD5\x93", DecodeError{4, 6, 3, 1, 0xF10, ReasonTailNotLast}},
+		{"\xD5\x93\xDA\x9D\xE0\xBC\x91", DecodeError{2, 4, 1, 3, 0xF11, ReasonTailOutOfRange}},
+	}
+
+	for _, p := range testsets {
+		_, err := DefaultEncoding.DecodeString(p.encoded)
+		testDecodeError(t, "DecodeString([% X])", p.encoded, err, p.want)
+
+		_, err = DefaultEncoding.AppendDecode(nil, []byte(p.encoded))
+		testDecodeError(t, "AppendDecode([% X])", p.encoded, err, p.want)
+
+		_, err = DefaultEncoding.Decode(make([]byte, 16), []rune(p.encoded))
+		testDecodeError(t, "Decode([% X])", p.encoded, err, p.want)
+
+		_, err = ioutil.ReadAll(NewDecoder(DefaultEncoding, strings.NewReader(p.encoded)))
+		testDecodeError(t, "NewDecoder([% X])", p.encoded, err, p.want)
+	}
+
+	_, err := DefaultEncoding.Strict().DecodeString("\xD5\x93\xCA\xAE")
+	testDecodeError(t, "Strict().DecodeString([% X])", "\xD5\x93\xCA\xAE", err,
+		DecodeError{1, 2, 1, 2, 0x2AE, ReasonNonCanonical})
+
+	// Runes cannot be truncated, so only the decoders of UTF-8 report it.
+	truncated := "\xD5\x93\n\xE0\xBC"
+	want := DecodeError{2, 3, 2, 1, utf8.RuneError, ReasonTruncated}
+
+	_, err = DefaultEncoding.DecodeString(truncated)
+	testDecodeError(t, "DecodeString([% X])", truncated, err, want)
+
+	_, err = DefaultEncoding.AppendDecode(nil, []byte(truncated))
+	testDecodeError(t, "AppendDecode([% X])", truncated, err, want)
+
+	_, err = ioutil.ReadAll(NewDecoder(DefaultEncoding, strings.NewReader(truncated)))
+	testDecodeError(t, "NewDecoder([% X])", truncated, err, want)
+}
+
+func testDecodeError(t *testing.T, msg string, encoded string, err error, want DecodeError) {
+	t.Helper()
+
+	var got *DecodeError
+	if !errors.As(err, &got) {
+		t.Errorf(msg+" = error %v, want *DecodeError", encoded, err)
+
+		return
+	}
+
+	if *got != want {
+		t.Errorf(msg+" = error %+v, want %+v", encoded, *got, want)
+	}
+}
+
+func TestDecodeErrorString(t *testing.T) {
+	err := &DecodeError{4, 6, 2, 3, 'Z', ReasonInvalidCharacter}
+	want := "illegal base2048 data at input 4 (line 2, column 3): invalid character 'Z'"
+	testEqual(t, "DecodeError.Error() = %q, want %q", err.Error(), want)
+
+	err = &DecodeError{1, 2, 1, 2, 0x2AE, ReasonNonCanonical}
+	want = "non-canonical base2048 data at input 1 (line 1, column 2): non-canonical character 'ʮ'"
+	testEqual(t, "DecodeError.Error() = %q, want %q", err.Error(), want)
+}
+
+func TestDecodeErrorAs(t *testing.T) {
+	var (
+		corrupt      CorruptInputError
+		nonCanonical NonCanonicalError
+	)
+
+	err := error(&DecodeError{Offset: 5, Reason: ReasonTailNotLast})
+	testEqual(t, "errors.As(CorruptInputError) = %v, want %v", errors.As(err, &corrupt), true)
+	testEqual(t, "CorruptInputError = %v, want %v", corrupt, CorruptInputError(5))
+	testEqual(t, "errors.As(NonCanonicalError) = %v, want %v", errors.As(err, &nonCanonical), false)
+
+	// Non-canonical input is also corrupt input.
+	err = &DecodeError{Offset: 7, Reason: ReasonNonCanonical}
+	testEqual(t, "errors.As(CorruptInputError) = %v, want %v", errors.As(err, &corrupt), true)
+	testEqual(t, "CorruptInputError = %v, want %v", corrupt, CorruptInputError(7))
+	testEqual(t, "errors.As(NonCanonicalError) = %v, want %v", errors.As(err, &nonCanonical), true)
+	testEqual(t, "NonCanonicalError = %v, want %v", nonCanonical, NonCanonicalError(7))
+}
+
+func TestDecodeErrorIs(t *testing.T) {
+	testsets := []struct {
+		encoded string
+		want    error
+	}{
+		{"\xD5\x93Z", ErrInvalidCharacter},
+		{"\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93", ErrTailNotLast},
+		{"\xD5\x93\xDA\x9D\xE0\xBC\x91", ErrTailOutOfRange},
+		{"\xD5\x93\xDA", ErrTruncated},
+		{"\xD5\x93\xE0\xBC", ErrTruncated},
+		{"\xD5\x93\xFF", ErrInvalidCharacter},
+	}
+	sentinels := []error{ErrInvalidCharacter, ErrTailNotLast, ErrTailOutOfRange, ErrNonCanonical, ErrTruncated}
+
+	for _, p := range testsets {
+		_, err := DefaultEncoding.DecodeString(p.encoded)
+
+		for _, sentinel := range sentinels {
+			testEqual(t, "errors.Is(DecodeString([% X]), %v) = %v, want %v", p.encoded, sentinel,
+				errors.Is(err, sentinel), sentinel == p.want)
+		}
+
+		_, err = ioutil.ReadAll(NewDecoder(DefaultEncoding, strings.NewReader(p.encoded)))
+
+		for _, sentinel := range sentinels {
+			testEqual(t, "errors.Is(NewDecoder([% X]), %v) = %v, want %v", p.encoded, sentinel,
+				errors.Is(err, sentinel), sentinel == p.want)
+		}
+	}
+
+	_, err := DefaultEncoding.Strict().DecodeString("\xCA\xAE")
+	testEqual(t, "errors.Is(DecodeString(), %v) = %v, want %v", ErrNonCanonical, errors.Is(err, ErrNonCanonical), true)
+}
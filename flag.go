@@ -0,0 +1,36 @@
+package base2048
+
+import "flag"
+
+// bytesValue is a flag.Value holding bytes given in base2048.
+type bytesValue struct {
+	enc *Encoding
+	p   *[]byte
+}
+
+// NewFlagValue returns a flag.Value which decodes the argument using enc and
+// stores the bytes in *p. The String method returns *p encoded using enc, so
+// that a non-empty *p is shown as the default value.
+func NewFlagValue(enc *Encoding, p *[]byte) flag.Value {
+	return &bytesValue{enc: enc, p: p}
+}
+
+// BytesVar defines a flag with the specified name and usage string on fs,
+// which is decoded using DefaultEncoding. The argument p points to a []byte
+// variable in which to store the value of the flag.
+func BytesVar(fs *flag.FlagSet, p *[]byte, name, usage string) {
+	fs.Var(NewFlagValue(DefaultEncoding, p), name, usage)
+}
+
+func (v *bytesValue) String() string {
+	// The flag package calls String on the zero value.
+	if v.p == nil {
+		return ""
+	}
+
+	return v.enc.EncodeToString(*v.p)
+}
+
+func (v *bytesValue) Set(s string) error {
+	return unmarshalString(v.enc, v.p, s)
+}
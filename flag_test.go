@@ -0,0 +1,51 @@
+package base2048
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBytesVar(t *testing.T) {
+	input := []byte("foobarbazqux")
+	encoded := DefaultEncoding.EncodeToString(input)
+
+	var key []byte
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	BytesVar(fs, &key, "key", "the key")
+
+	err := fs.Parse([]string{"-key", encoded})
+	testEqual(t, "Parse() = error %v, want %v", err, error(nil))
+	testEqual(t, "Parse() = %q, want %q", string(key), string(input))
+	testEqual(t, "String() = %q, want %q", fs.Lookup("key").Value.String(), encoded)
+
+	err = fs.Parse([]string{"-key", "Z"})
+	if err == nil || !strings.Contains(err.Error(), CorruptInputError(0).Error()) {
+		t.Errorf("Parse() = error %v, want %v", err, CorruptInputError(0))
+	}
+}
+
+func TestNewFlagValue(t *testing.T) {
+	enc := DefaultEncoding.WithGroups(4, '-')
+	input := []byte("foobarbazqux")
+	key := []byte("default")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(NewFlagValue(enc, &key), "key", "the key")
+
+	bb := &bytes.Buffer{}
+	fs.SetOutput(bb)
+	fs.PrintDefaults()
+
+	if want := enc.EncodeToString([]byte("default")); !strings.Contains(bb.String(), want) {
+		t.Errorf("PrintDefaults() = %q, want default %q", bb.String(), want)
+	}
+
+	err := fs.Parse([]string{"-key=" + enc.EncodeToString(input)})
+	testEqual(t, "Parse() = error %v, want %v", err, error(nil))
+	testEqual(t, "Parse() = %q, want %q", string(key), string(input))
+}
@@ -0,0 +1,112 @@
+package base2048
+
+import "encoding/json"
+
+// Bytes is a byte slice marshaled as base2048 text with DefaultEncoding.
+// It implements encoding.TextMarshaler, encoding.TextUnmarshaler,
+// json.Marshaler and json.Unmarshaler, so that encoding/json and other
+// packages using them encode it as a base2048 string instead of base64.
+// A nil Bytes is marshaled to JSON as null, as a nil []byte is.
+type Bytes []byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bytes) MarshalText() ([]byte, error) {
+	return marshalText(DefaultEncoding, b)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Bytes) UnmarshalText(text []byte) error {
+	return unmarshalText(DefaultEncoding, (*[]byte)(b), text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return marshalJSON(DefaultEncoding, b)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Unmarshaling null leaves b
+// unchanged.
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(DefaultEncoding, (*[]byte)(b), data)
+}
+
+// EncodedBytes is like Bytes but is marshaled with Encoding, or
+// DefaultEncoding if Encoding is nil. To unmarshal with another encoding,
+// set Encoding before unmarshaling.
+type EncodedBytes struct {
+	Encoding *Encoding
+	Bytes    []byte
+}
+
+// encoding returns the encoding of b.
+func (b *EncodedBytes) encoding() *Encoding {
+	if b.Encoding == nil {
+		return DefaultEncoding
+	}
+
+	return b.Encoding
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b EncodedBytes) MarshalText() ([]byte, error) {
+	return marshalText(b.encoding(), b.Bytes)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *EncodedBytes) UnmarshalText(text []byte) error {
+	return unmarshalText(b.encoding(), &b.Bytes, text)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b EncodedBytes) MarshalJSON() ([]byte, error) {
+	return marshalJSON(b.encoding(), b.Bytes)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Unmarshaling null leaves b
+// unchanged.
+func (b *EncodedBytes) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(b.encoding(), &b.Bytes, data)
+}
+
+func marshalText(enc *Encoding, b []byte) ([]byte, error) {
+	return enc.AppendEncode(nil, b), nil
+}
+
+func unmarshalText(enc *Encoding, dst *[]byte, text []byte) error {
+	return unmarshalString(enc, dst, string(text))
+}
+
+// unmarshalString decodes s into *dst. It leaves *dst unchanged on error.
+func unmarshalString(enc *Encoding, dst *[]byte, s string) error {
+	b, err := enc.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	*dst = b
+
+	return nil
+}
+
+func marshalJSON(enc *Encoding, b []byte) ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(enc.EncodeToString(b)) //nolint:wrapcheck
+}
+
+// unmarshalJSON decodes the JSON string data into *dst. It leaves *dst
+// unchanged if data is null or on error.
+func unmarshalJSON(enc *Encoding, dst *[]byte, data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return unmarshalString(enc, dst, s)
+}
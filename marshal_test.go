@@ -0,0 +1,119 @@
+package base2048
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var (
+	_ encoding.TextMarshaler   = Bytes(nil)
+	_ encoding.TextUnmarshaler = (*Bytes)(nil)
+	_ json.Marshaler           = Bytes(nil)
+	_ json.Unmarshaler         = (*Bytes)(nil)
+	_ encoding.TextMarshaler   = EncodedBytes{}
+	_ encoding.TextUnmarshaler = (*EncodedBytes)(nil)
+	_ json.Marshaler           = EncodedBytes{}
+	_ json.Unmarshaler         = (*EncodedBytes)(nil)
+)
+
+func TestBytesText(t *testing.T) {
+	for _, p := range testsets {
+		text, err := Bytes(p.decoded).MarshalText()
+		testEqual(t, "MarshalText(%q) = error %v, want %v", p.decoded, err, error(nil))
+		testEqual(t, "MarshalText(%q) = %q, want %q", p.decoded, string(text), p.encoded)
+
+		var b Bytes
+		err = b.UnmarshalText([]byte(p.encoded))
+		testEqual(t, "UnmarshalText(%q) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "UnmarshalText(%q) = %q, want %q", p.encoded, string(b), p.decoded)
+	}
+
+	b := Bytes("foo")
+	err := b.UnmarshalText([]byte("Z"))
+	testEqual(t, "UnmarshalText(%q) = error %v, want %v", "Z", asPositionError(err), error(CorruptInputError(0)))
+	testEqual(t, "UnmarshalText(%q) = %q, want %q", "Z", string(b), "foo")
+}
+
+func TestBytesJSON(t *testing.T) {
+	type record struct {
+		Key  Bytes  `json:"key"`
+		Tag  Bytes  `json:"tag"`
+		Opt  Bytes  `json:"opt,omitempty"`
+		Note string `json:"note"`
+	}
+
+	in := record{Key: Bytes("foobar"), Tag: Bytes{}, Note: "x"}
+	want := `{"key":"` + DefaultEncoding.EncodeToString([]byte("foobar")) + `","tag":"","note":"x"}`
+
+	data, err := json.Marshal(in)
+	testEqual(t, "Marshal() = error %v, want %v", err, error(nil))
+	testEqual(t, "Marshal() = %s, want %s", string(data), want)
+
+	var out record
+	err = json.Unmarshal(data, &out)
+	testEqual(t, "Unmarshal(%s) = error %v, want %v", data, err, error(nil))
+	testEqual(t, "Unmarshal(%s).Key = %q, want %q", data, string(out.Key), "foobar")
+	testEqual(t, "Unmarshal(%s).Tag is nil = %v, want %v", data, out.Tag == nil, false)
+	testEqual(t, "Unmarshal(%s).Opt is nil = %v, want %v", data, out.Opt == nil, true)
+
+	data, err = json.Marshal(record{})
+	testEqual(t, "Marshal() = error %v, want %v", err, error(nil))
+	testEqual(t, "Marshal() = %s, want %s", string(data), `{"key":null,"tag":null,"note":""}`)
+
+	// null leaves the value unchanged.
+	out = record{Key: Bytes("foo")}
+	err = json.Unmarshal([]byte(`{"key":null}`), &out)
+	testEqual(t, "Unmarshal(null) = error %v, want %v", err, error(nil))
+	testEqual(t, "Unmarshal(null) = %q, want %q", string(out.Key), "foo")
+
+	err = json.Unmarshal([]byte(`{"key":"Z"}`), &out)
+	if !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Unmarshal(%q) = error %v, want %v", "Z", err, ErrInvalidCharacter)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+
+	err = json.Unmarshal([]byte(`{"key":1}`), &out)
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Unmarshal(1) = error %v, want *json.UnmarshalTypeError", err)
+	}
+}
+
+func TestEncodedBytes(t *testing.T) {
+	enc := DefaultEncoding.WithLineWrap(4, LF)
+	input := []byte("foobarbazqux")
+	encoded := enc.EncodeToString(input)
+
+	text, err := EncodedBytes{enc, input}.MarshalText()
+	testEqual(t, "MarshalText() = error %v, want %v", err, error(nil))
+	testEqual(t, "MarshalText() = %q, want %q", string(text), encoded)
+
+	b := EncodedBytes{Encoding: enc}
+	err = b.UnmarshalText(text)
+	testEqual(t, "UnmarshalText() = error %v, want %v", err, error(nil))
+	testEqual(t, "UnmarshalText() = %q, want %q", string(b.Bytes), string(input))
+
+	data, err := json.Marshal(EncodedBytes{enc, input})
+	testEqual(t, "Marshal() = error %v, want %v", err, error(nil))
+
+	want, _ := json.Marshal(encoded)
+	testEqual(t, "Marshal() = %s, want %s", string(data), string(want))
+
+	b = EncodedBytes{Encoding: enc.Strict()}
+	err = json.Unmarshal(data, &b)
+	testEqual(t, "Strict() Unmarshal(%s) = error %v, want %v", data, asPositionError(err), error(CorruptInputError(4)))
+
+	// A nil Encoding is DefaultEncoding.
+	data, err = json.Marshal(EncodedBytes{Bytes: input})
+	testEqual(t, "Marshal() = error %v, want %v", err, error(nil))
+
+	want, _ = json.Marshal(Bytes(input))
+	testEqual(t, "Marshal() = %s, want %s", string(data), string(want))
+
+	b = EncodedBytes{}
+	err = json.Unmarshal(data, &b)
+	testEqual(t, "Unmarshal(%s) = error %v, want %v", data, err, error(nil))
+	testEqual(t, "Unmarshal(%s) = %q, want %q", data, string(b.Bytes), string(input))
+}
@@ -0,0 +1,55 @@
+package base2048
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Value implements driver.Valuer. It returns the base2048 string of b, or
+// nil to store NULL if b is nil.
+func (b Bytes) Value() (driver.Value, error) {
+	return value(DefaultEncoding, b)
+}
+
+// Scan implements sql.Scanner. It decodes a string or []byte value, and sets
+// b to nil for NULL.
+func (b *Bytes) Scan(src interface{}) error {
+	return scan(DefaultEncoding, (*[]byte)(b), src)
+}
+
+// Value implements driver.Valuer. It returns the base2048 string of b.Bytes,
+// or nil to store NULL if b.Bytes is nil.
+func (b EncodedBytes) Value() (driver.Value, error) {
+	return value(b.encoding(), b.Bytes)
+}
+
+// Scan implements sql.Scanner. It decodes a string or []byte value, and sets
+// b.Bytes to nil for NULL.
+func (b *EncodedBytes) Scan(src interface{}) error {
+	return scan(b.encoding(), &b.Bytes, src)
+}
+
+func value(enc *Encoding, b []byte) (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	return enc.EncodeToString(b), nil
+}
+
+// scan decodes the column value src into *dst. It leaves *dst unchanged on
+// error.
+func scan(enc *Encoding, dst *[]byte, src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*dst = nil
+
+		return nil
+	case string:
+		return unmarshalString(enc, dst, v)
+	case []byte:
+		return unmarshalString(enc, dst, string(v))
+	}
+
+	return fmt.Errorf("base2048: cannot scan %T into bytes", src)
+}
@@ -0,0 +1,59 @@
+package base2048
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+var (
+	_ sql.Scanner   = (*Bytes)(nil)
+	_ driver.Valuer = Bytes(nil)
+	_ sql.Scanner   = (*EncodedBytes)(nil)
+	_ driver.Valuer = EncodedBytes{}
+)
+
+func TestBytesValue(t *testing.T) {
+	for _, p := range testsets {
+		v, err := Bytes(p.decoded).Value()
+		testEqual(t, "Value(%q) = error %v, want %v", p.decoded, err, error(nil))
+		testEqual(t, "Value(%q) = %q, want %q", p.decoded, v, driver.Value(p.encoded))
+	}
+
+	v, err := Bytes(nil).Value()
+	testEqual(t, "Value(nil) = error %v, want %v", err, error(nil))
+	testEqual(t, "Value(nil) = %v, want %v", v, driver.Value(nil))
+
+	enc := DefaultEncoding.WithLineWrap(4, LF)
+	input := []byte("foobarbazqux")
+	v, err = EncodedBytes{enc, input}.Value()
+	testEqual(t, "Value() = error %v, want %v", err, error(nil))
+	testEqual(t, "Value() = %q, want %q", v, driver.Value(enc.EncodeToString(input)))
+}
+
+func TestBytesScan(t *testing.T) {
+	for _, p := range testsets {
+		var b Bytes
+		err := b.Scan(p.encoded)
+		testEqual(t, "Scan(%q) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "Scan(%q) = %q, want %q", p.encoded, string(b), p.decoded)
+
+		var eb EncodedBytes
+		err = eb.Scan([]byte(p.encoded))
+		testEqual(t, "Scan([]byte(%q)) = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "Scan([]byte(%q)) = %q, want %q", p.encoded, string(eb.Bytes), p.decoded)
+	}
+
+	b := Bytes("foo")
+	err := b.Scan(nil)
+	testEqual(t, "Scan(nil) = error %v, want %v", err, error(nil))
+	testEqual(t, "Scan(nil) is nil = %v, want %v", b == nil, true)
+
+	b = Bytes("foo")
+	err = b.Scan("\xD5\x93\xDA\x9DZ")
+	testEqual(t, "Scan() = error %v, want %v", asPositionError(err), error(CorruptInputError(2)))
+	testEqual(t, "Scan() = %q, want %q", string(b), "foo")
+
+	err = b.Scan(int64(1))
+	testEqual(t, "Scan(1) = error %v, want %v", err.Error(), "base2048: cannot scan int64 into bytes")
+}
@@ -0,0 +1,308 @@
+package base2048
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// Number of blocks encoded at once by the streaming encoder.
+	encoderBlocks = 64
+
+	// Size of the output buffer of the streaming decoder.
+	decoderBufSize = 1024
+)
+
+type encoder struct {
+	err    error
+	enc    *Encoding
+	w      io.Writer
+	buf    [bytesPerBlock]byte // buffered data waiting to be encoded
+	nbuf   int                 // number of bytes in buf
+	out    []byte              // output buffer
+	chars  int                 // number of characters of the encoded data written
+	crc    uint32              // checksum of the data written
+	closed bool
+}
+
+// NewEncoder returns a new base2048 stream encoder. Data written to the
+// returned writer will be encoded using enc and then written to w as UTF-8,
+// split into lines if enc wraps lines.
+// Base2048 encodings operate in 11-byte blocks; when finished writing,
+// the caller must Close the returned encoder to flush any partially
+// written blocks, and the checksum if enc has one.
+func NewEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
+	return &encoder{enc: enc, w: w}
+}
+
+func (e *encoder) Write(p []byte) (n int, err error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	e.crc = e.enc.updateChecksum(e.crc, p)
+
+	// Leading fringe.
+	if e.nbuf > 0 {
+		var i int
+		for i = 0; i < len(p) && e.nbuf < bytesPerBlock; i++ {
+			e.buf[e.nbuf] = p[i]
+			e.nbuf++
+		}
+
+		n += i
+		p = p[i:]
+
+		if e.nbuf < bytesPerBlock {
+			return n, nil
+		}
+
+		if e.err = e.flush(e.buf[:]); e.err != nil {
+			return n, e.err
+		}
+
+		e.nbuf = 0
+	}
+
+	// Large interior chunks.
+	for len(p) >= bytesPerBlock {
+		nn := encoderBlocks * bytesPerBlock
+		if nn > len(p) {
+			nn = len(p) - len(p)%bytesPerBlock
+		}
+
+		if e.err = e.flush(p[:nn]); e.err != nil {
+			return n, e.err
+		}
+
+		n += nn
+		p = p[nn:]
+	}
+
+	// Trailing fringe.
+	copy(e.buf[:], p)
+	e.nbuf = len(p)
+	n += len(p)
+
+	return n, nil
+}
+
+// Close flushes any pending output from the encoder.
+// It is an error to call Write after calling Close.
+func (e *encoder) Close() error {
+	if e.closed {
+		return e.err
+	}
+
+	e.closed = true
+
+	// Append the checksum to the rest of the data, which can be longer
+	// than a block.
+	if e.err == nil && e.enc.checksum {
+		var buf [bytesPerBlock + checksumSize]byte
+
+		n := copy(buf[:], e.buf[:e.nbuf])
+		binary.LittleEndian.PutUint32(buf[n:], e.crc)
+		e.err = e.flush(buf[:n+checksumSize])
+		e.nbuf = 0
+	}
+
+	// If there's anything left in the buffer, flush it out
+	if e.err == nil && e.nbuf > 0 {
+		e.err = e.flush(e.buf[:e.nbuf])
+		e.nbuf = 0
+	}
+
+	return e.err
+}
+
+// flush encodes src and writes the result to the underlying writer.
+func (e *encoder) flush(src []byte) error {
+	e.out = e.enc.appendEncode(e.out[:0], src, e.chars)
+	e.chars += e.enc.dataLen(len(src))
+
+	_, err := e.w.Write(e.out)
+
+	return err //nolint:wrapcheck
+}
+
+type decoder struct {
+	err        error
+	enc        *Encoding
+	r          *bufio.Reader
+	dec        charDecoder
+	prefix     []byte   // line prefix of the encoding
+	pos        position // position of the next character
+	pendingPos position // position of the pending character
+	out        []byte   // leftover decoded output
+	outbuf     [decoderBufSize]byte
+	total      int // number of bytes returned so far
+	held       [checksumSize]byte
+	nheld      int // number of bytes held back in held
+}
+
+// NewDecoder constructs a new base2048 stream decoder. It reads UTF-8
+// encoded characters from r. New line characters (\r and \n) and
+// the characters set by WithIgnore are ignored, and the line prefix of enc is
+// stripped from the start of each line, unless enc is strict.
+// The last character is held back until r returns io.EOF, so that the
+// trailing character is only accepted at the end of the stream.
+// If enc has a limit set by WithMaxDecodedLen, reading fails with ErrTooLarge
+// after returning the bytes up to the limit.
+// If enc has a checksum, the last bytes are held back until r returns io.EOF,
+// and reading fails with ErrChecksum if the checksum does not match.
+func NewDecoder(enc *Encoding, r io.Reader) io.Reader {
+	return &decoder{
+		enc:    enc,
+		r:      bufio.NewReader(r),
+		dec:    newCharDecoder(enc),
+		prefix: []byte(string(enc.linePrefix)),
+		pos:    startPosition,
+	}
+}
+
+func (d *decoder) Read(p []byte) (n int, err error) {
+	for len(d.out) == 0 && d.err == nil {
+		d.fill()
+	}
+
+	// Use leftover decoded output before returning the error.
+	if len(d.out) > 0 {
+		n = copy(p, d.out)
+		d.out = d.out[n:]
+
+		return n, nil
+	}
+
+	return 0, d.err
+}
+
+// fill decodes characters read from the underlying reader into the output
+// buffer, until the buffer is full or no more input is available without
+// blocking.
+func (d *decoder) fill() {
+	n := copy(d.outbuf[:], d.held[:d.nheld])
+	start := n
+
+	for n+maxBytesPerChar <= len(d.outbuf) {
+		if n > start && d.r.Buffered() == 0 {
+			break
+		}
+
+		if d.dec.atLineStart() && d.skipLinePrefix() {
+			d.dec.endLineStart()
+
+			continue
+		}
+
+		r, size, err := d.r.ReadRune()
+		if err != nil {
+			if err == io.EOF {
+				written, reason := d.dec.flush(d.outbuf[n:], true)
+				n += written
+
+				if reason != 0 {
+					err = decodeError(d.pendingPos, d.dec.pending, reason)
+				}
+			}
+
+			d.err = err
+
+			break
+		}
+
+		pos := d.pos
+		d.pos.advance(r, size)
+
+		if d.dec.skip(r) {
+			continue
+		}
+
+		written, reason := d.dec.flush(d.outbuf[n:], false)
+		n += written
+
+		if reason != 0 {
+			d.err = decodeError(d.pendingPos, d.dec.pending, reason)
+
+			break
+		}
+
+		if r == utf8.RuneError && size == 1 && d.truncated() {
+			d.err = decodeError(pos, r, ReasonTruncated)
+
+			break
+		}
+
+		d.dec.hold(r)
+		d.pendingPos = pos
+	}
+
+	n = d.holdChecksum(n)
+	d.out = d.outbuf[:n]
+	d.total += n
+
+	// Return the bytes up to the limit before the error.
+	if d.enc.tooLarge(d.total) {
+		d.out = d.out[:len(d.out)-(d.total-d.enc.maxDecodedLen)]
+		d.err = ErrTooLarge
+	}
+}
+
+// holdChecksum holds back the last bytes of the n bytes in the output buffer,
+// which may be the checksum, until the end of the input, and returns
+// the number of bytes to return. At the end, it verifies the checksum.
+func (d *decoder) holdChecksum(n int) int {
+	if !d.enc.checksum {
+		return n
+	}
+
+	if d.err == io.EOF {
+		d.nheld = 0
+
+		n, err := trimChecksum(n, d.dec.crc)
+		if err != nil {
+			d.err = err
+		}
+
+		return n
+	}
+
+	k := n - checksumSize
+	if k < 0 {
+		k = 0
+	}
+
+	d.nheld = copy(d.held[:], d.outbuf[k:n])
+
+	return k
+}
+
+// truncated reports whether the input ends in the middle of the character
+// just read as utf8.RuneError.
+func (d *decoder) truncated() bool {
+	_ = d.r.UnreadRune()
+	b, err := d.r.Peek(utf8.UTFMax)
+	_, _ = d.r.Discard(1)
+
+	return err == io.EOF && !utf8.FullRune(b)
+}
+
+// skipLinePrefix discards the line prefix if the input continues with it,
+// and reports whether it is discarded.
+func (d *decoder) skipLinePrefix() bool {
+	b, err := d.r.Peek(len(d.prefix))
+	if err != nil || !bytes.Equal(b, d.prefix) {
+		return false
+	}
+
+	_, _ = d.r.Discard(len(d.prefix))
+
+	for _, r := range d.enc.linePrefix {
+		d.pos.advance(r, utf8.RuneLen(r))
+	}
+
+	return true
+}
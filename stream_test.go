@@ -0,0 +1,275 @@
+package base2048
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type errorWriter struct {
+	err error
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestEncoder(t *testing.T) {
+	for _, p := range testsets {
+		bb := &bytes.Buffer{}
+		encoder := NewEncoder(DefaultEncoding, bb)
+		_, err := encoder.Write([]byte(p.decoded))
+		testEqual(t, "Write(%q) = error %v, want %v", p.decoded, err, error(nil))
+		err = encoder.Close()
+		testEqual(t, "Close(%q) = error %v, want %v", p.decoded, err, error(nil))
+		testEqual(t, "Encode(%q) = [% X], want [% X]", p.decoded, bb.String(), p.encoded)
+	}
+}
+
+func TestEncoderBuffering(t *testing.T) {
+	input := bytes.Repeat([]byte("foobarbazqux"), 200)
+	want := DefaultEncoding.EncodeToString(input)
+
+	for bs := 1; bs <= 40; bs++ {
+		bb := &bytes.Buffer{}
+		encoder := NewEncoder(DefaultEncoding, bb)
+
+		for pos := 0; pos < len(input); pos += bs {
+			end := pos + bs
+			if end > len(input) {
+				end = len(input)
+			}
+
+			n, err := encoder.Write(input[pos:end])
+			testEqual(t, "Write(%q) = error %v, want %v", input[pos:end], err, error(nil))
+			testEqual(t, "Write(%q) = length %v, want %v", input[pos:end], n, end-pos)
+		}
+
+		err := encoder.Close()
+		testEqual(t, "Close() = error %v, want %v", err, error(nil))
+		testEqual(t, "Encoding/%d = %q, want %q", bs, bb.String(), want)
+	}
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	want := errors.New("write error")
+	encoder := NewEncoder(DefaultEncoding, &errorWriter{want})
+
+	_, err := encoder.Write([]byte("foo"))
+	testEqual(t, "Write() = error %v, want %v", err, error(nil))
+
+	err = encoder.Close()
+	testEqual(t, "Close() = error %v, want %v", err, want)
+
+	_, err = encoder.Write([]byte("foo"))
+	testEqual(t, "Write() = error %v, want %v", err, want)
+}
+
+func TestDecoder(t *testing.T) {
+	for _, p := range testsets {
+		decoder := NewDecoder(DefaultEncoding, strings.NewReader(p.encoded))
+		dbuf, err := ioutil.ReadAll(decoder)
+		testEqual(t, "Read from %q = error %v, want %v", p.encoded, err, error(nil))
+		testEqual(t, "Read from %q = %q, want %q", p.encoded, string(dbuf), p.decoded)
+	}
+}
+
+func TestDecoderBuffering(t *testing.T) {
+	input := bytes.Repeat([]byte("foobarbazqux"), 200)
+	encoded := DefaultEncoding.EncodeToString(input)
+
+	for bs := 1; bs <= 40; bs++ {
+		decoder := NewDecoder(DefaultEncoding, iotest.OneByteReader(strings.NewReader(encoded)))
+		buf := make([]byte, len(input)+12)
+		total := 0
+
+		for total < len(buf) {
+			end := total + bs
+			if end > len(buf) {
+				end = len(buf)
+			}
+
+			n, err := decoder.Read(buf[total:end])
+			total += n
+
+			if err == io.EOF {
+				break
+			}
+
+			testEqual(t, "Read from %q at pos %d = error %v, want %v", encoded, total, err, error(nil))
+		}
+
+		testEqual(t, "Decoding/%d = %q, want %q", bs, string(buf[:total]), string(input))
+	}
+}
+
+func TestDecoderWithCRLF(t *testing.T) {
+	input := []byte("foobarbazqux")
+	encoded := DefaultEncoding.EncodeToString(input)
+	runes := []rune(encoded)
+	wrapped := "\r\n" + string(runes[:3]) + "\r\n" + string(runes[3:]) + "\r\n"
+
+	decoder := NewDecoder(DefaultEncoding, strings.NewReader(wrapped))
+	dbuf, err := ioutil.ReadAll(decoder)
+	testEqual(t, "Read from %q = error %v, want %v", wrapped, err, error(nil))
+	testEqual(t, "Read from %q = %q, want %q", wrapped, string(dbuf), string(input))
+}
+
+func TestDecoderError(t *testing.T) {
+	testerrors := []struct {
+		decoded, encoded string
+		pos              int64
+	}{
+		// illegal character
+		{"", "Z", 0},
+		// illegal character in the middle
+		{"fooba", "\xD5\x93\xDA\x9D\xE0\xB6\xAA\xE0\xB0\xA8Z\xC5\x8A", 4},
+		// illegal character at the last
+		{"fo", "\xD5\x93\xDA\x9DZ", 2},
+		// trailing character (\xE0\xBC\x90) in the middle
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x90\xD5\x93", 2},
+		// trailing character followed by newline and another character
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x90\n\xD5\x93", 2},
+		// illegal trailing character (\xE0\xBC\x91) at the last
+		{"fo", "\xD5\x93\xDA\x9D\xE0\xBC\x91", 2},
+		// invalid UTF-8
+		{"f", "\xD5\x93\xDA", 1},
+	}
+
+	for _, p := range testerrors {
+		decoder := NewDecoder(DefaultEncoding, strings.NewReader(p.encoded))
+		dbuf, err := ioutil.ReadAll(decoder)
+		want := CorruptInputError(p.pos)
+
+		if !reflect.DeepEqual(want, asPositionError(err)) {
+			t.Errorf("Read from [% X] = error %v, want %v", p.encoded, err, want)
+		}
+
+		if string(dbuf) != p.decoded {
+			t.Errorf("Read from [% X] = %q, want %q", p.encoded, dbuf, p.decoded)
+		}
+	}
+}
+
+func TestEncoderDecoderRoundTrip(t *testing.T) {
+	input := make([]byte, 4096)
+	for i := range input {
+		input[i] = byte(i * 7)
+	}
+
+	bb := &bytes.Buffer{}
+	encoder := NewEncoder(DefaultEncoding, bb)
+	_, _ = encoder.Write(input)
+	_ = encoder.Close()
+
+	dbuf, err := ioutil.ReadAll(NewDecoder(DefaultEncoding, bb))
+	testEqual(t, "ReadAll() = error %v, want %v", err, error(nil))
+
+	if !bytes.Equal(dbuf, input) {
+		t.Errorf("Decode(Encode()) = [% X], want [% X]", dbuf, input)
+	}
+}
+
+func TestEncoderWithLineWrap(t *testing.T) {
+	input := bytes.Repeat([]byte("foobarbazqux"), 20)
+	enc := DefaultEncoding.WithLineWrap(7, CRLF).WithLinePrefix("// ")
+	want := enc.EncodeToString(input)
+
+	for bs := 1; bs <= 24; bs++ {
+		bb := &bytes.Buffer{}
+		encoder := NewEncoder(enc, bb)
+
+		for pos := 0; pos < len(input); pos += bs {
+			end := pos + bs
+			if end > len(input) {
+				end = len(input)
+			}
+
+			_, _ = encoder.Write(input[pos:end])
+		}
+
+		_ = encoder.Close()
+		testEqual(t, "Encoding/%d = %q, want %q", bs, bb.String(), want)
+	}
+}
+
+func TestDecoderWithLinePrefix(t *testing.T) {
+	input := bytes.Repeat([]byte("foobarbazqux"), 20)
+	enc := DefaultEncoding.WithLineWrap(7, CRLF).WithLinePrefix("// ")
+	encoded := enc.EncodeToString(input) + "\r\n"
+
+	decoder := NewDecoder(enc, iotest.HalfReader(strings.NewReader(encoded)))
+	dbuf, err := ioutil.ReadAll(decoder)
+	testEqual(t, "ReadAll() = error %v, want %v", err, error(nil))
+	testEqual(t, "ReadAll() = %q, want %q", string(dbuf), string(input))
+
+	// Error positions count the stripped prefixes.
+	decoder = NewDecoder(enc, strings.NewReader("// \xD5\x93\n// Z"))
+	_, err = ioutil.ReadAll(decoder)
+	testEqual(t, "ReadAll() = error %v, want %v", asPositionError(err), error(CorruptInputError(8)))
+}
+
+func TestDecoderMatchesDecode(t *testing.T) {
+	encodings := []*Encoding{
+		DefaultEncoding.WithLineWrap(5, CRLF).WithLinePrefix("# "),
+		DefaultEncoding.WithLineWrap(5, LF).WithLinePrefix(" >").WithIgnore(IgnoreSpaces),
+		DefaultEncoding.WithLineWrap(6, LF).WithGroups(2, '-').WithChecksum(),
+		DefaultEncoding.WithLinePrefix("# ").Strict(),
+	}
+	input := benchData(30)
+
+	for _, enc := range encodings {
+		encoded := enc.EncodeToString(input)
+		tests := []string{
+			encoded,
+			"  " + encoded + "\n",
+			strings.Replace(encoded, "\n", "\n  ", -1),
+			strings.Replace(encoded, "\n", "\nZ", 1),
+			encoded[:len(encoded)-1],
+		}
+
+		for _, s := range tests {
+			want, wantErr := enc.DecodeString(s)
+			if s == encoded && !enc.strict && wantErr != nil {
+				t.Errorf("DecodeString(%q) = error %v, want %v", s, wantErr, error(nil))
+			}
+
+			// Runes cannot be truncated, so Decode reports the invalid
+			// character instead.
+			wantRunesErr := wantErr
+
+			var de *DecodeError
+			if errors.As(wantErr, &de) && de.Reason == ReasonTruncated {
+				e := *de
+				e.Reason = ReasonInvalidCharacter
+				wantRunesErr = &e
+			}
+
+			runes := []rune(s)
+			dbuf := make([]byte, enc.DecodedLen(len(runes)))
+			n, err := enc.Decode(dbuf, runes)
+
+			if !reflect.DeepEqual(err, wantRunesErr) {
+				t.Errorf("Decode(%q) = error %v, want %v", s, err, wantRunesErr)
+			}
+
+			testEqual(t, "Decode(%q) = %x, want %x", s, string(dbuf[:n]), string(want))
+
+			dbuf, err = ioutil.ReadAll(NewDecoder(enc, iotest.OneByteReader(strings.NewReader(s))))
+
+			if !reflect.DeepEqual(err, wantErr) {
+				t.Errorf("NewDecoder(%q) = error %v, want %v", s, err, wantErr)
+			}
+
+			// The stream decoder holds back the bytes which may be the checksum.
+			if wantErr == nil || !enc.checksum {
+				testEqual(t, "NewDecoder(%q) = %x, want %x", s, string(dbuf), string(want))
+			}
+		}
+	}
+}
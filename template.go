@@ -0,0 +1,55 @@
+package base2048
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// FuncMap returns the functions for text/template and html/template backed
+// by enc:
+//
+//	base2048Encode DATA        encodes DATA
+//	base2048Decode TEXT        decodes TEXT into a string
+//	base2048Wrap WIDTH DATA    encodes DATA into lines of WIDTH characters
+//
+// DATA is a string, []byte or Bytes. Use html/template.FuncMap(m) to convert
+// the result for html/template.
+func (enc *Encoding) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"base2048Encode": func(data interface{}) (string, error) {
+			b, err := templateData(data)
+			if err != nil {
+				return "", err
+			}
+
+			return enc.EncodeToString(b), nil
+		},
+		"base2048Decode": func(text string) (string, error) {
+			b, err := enc.DecodeString(text)
+
+			return string(b), err
+		},
+		"base2048Wrap": func(width int, data interface{}) (string, error) {
+			b, err := templateData(data)
+			if err != nil {
+				return "", err
+			}
+
+			return enc.WithLineWrap(width, LF).EncodeToString(b), nil
+		},
+	}
+}
+
+// templateData returns the bytes of the data given to the template functions.
+func templateData(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case Bytes:
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("base2048: cannot encode %T", data)
+}
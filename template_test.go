@@ -0,0 +1,61 @@
+package base2048
+
+import (
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFuncMap(t *testing.T) {
+	input := []byte("foobarbazqux")
+	encoded := DefaultEncoding.EncodeToString(input)
+	runes := []rune(encoded)
+	wrapped := string(runes[:4]) + "\n" + string(runes[4:8]) + "\n" + string(runes[8:])
+
+	testsets := []struct {
+		text string
+		data interface{}
+		want string
+	}{
+		{`{{base2048Encode .}}`, string(input), encoded},
+		{`{{base2048Encode .}}`, input, encoded},
+		{`{{. | base2048Encode}}`, Bytes(input), encoded},
+		{`{{base2048Decode .}}`, encoded, string(input)},
+		{`{{. | base2048Encode | base2048Decode}}`, input, string(input)},
+		{`{{. | base2048Wrap 4}}`, input, wrapped},
+	}
+
+	for _, p := range testsets {
+		tmpl := template.Must(template.New("").Funcs(DefaultEncoding.FuncMap()).Parse(p.text))
+		sb := &strings.Builder{}
+		err := tmpl.Execute(sb, p.data)
+		testEqual(t, "Execute(%q) = error %v, want %v", p.text, err, error(nil))
+		testEqual(t, "Execute(%q) = %q, want %q", p.text, sb.String(), p.want)
+	}
+
+	testerrors := []struct {
+		text string
+		data interface{}
+	}{
+		{`{{base2048Encode .}}`, 1},
+		{`{{base2048Decode .}}`, "Z"},
+		{`{{base2048Wrap 4 .}}`, 1},
+	}
+
+	for _, p := range testerrors {
+		tmpl := template.Must(template.New("").Funcs(DefaultEncoding.FuncMap()).Parse(p.text))
+		err := tmpl.Execute(&strings.Builder{}, p.data)
+
+		if err == nil {
+			t.Errorf("Execute(%q) = error %v, want error", p.text, err)
+		}
+	}
+
+	// The functions are usable with html/template.
+	tmpl := htmltemplate.Must(htmltemplate.New("").Funcs(htmltemplate.FuncMap(DefaultEncoding.FuncMap())).Parse(`<p>{{base2048Encode .}}</p>`))
+	sb := &strings.Builder{}
+	err := tmpl.Execute(sb, input)
+	testEqual(t, "Execute() = error %v, want %v", err, error(nil))
+	testEqual(t, "Execute() = %q, want %q", sb.String(), "<p>"+encoded+"</p>")
+}